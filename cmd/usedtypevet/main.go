@@ -0,0 +1,12 @@
+// The usedtypevet command runs the usedtype analyzer as a standalone tool, which can also be used as the vet tool
+// via "go vet -vettool=$(which usedtypevet)".
+package main
+
+import (
+	"github.com/magodo/usedtype/usedtype"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(usedtype.Analyzer)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/magodo/usedtype/usedtype"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// loadResult loads the struct full usages from either a result file saved by "-format json", or a package directory
+// to analyze.
+func loadResult(ctx context.Context, path string) usedtype.JSONStructFullUsages {
+	fi, err := os.Stat(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if fi.IsDir() {
+		if *pattern == "" {
+			log.Fatalf("-p is required to analyze the package directory %s", path)
+		}
+		targetNamedTypeAllocSet, directUsage, buildOpt, _ := analyze(ctx, path, []string{"./..."})
+		return buildStructFullUsages(ctx, targetNamedTypeAllocSet, directUsage, buildOpt).ToJSON(renderOption())
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var fus usedtype.JSONStructFullUsages
+	if err := json.Unmarshal(b, &fus); err != nil {
+		log.Fatalf("unmarshalling %s: %v", path, err)
+	}
+	return fus
+}
+
+func runDiff(ctx context.Context, args []string) {
+	oldFus, newFus := loadResult(ctx, args[0]), loadResult(ctx, args[1])
+	d, err := usedtype.DiffStructFullUsages(oldFus, newFus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !d.IsEmpty() {
+		fmt.Println(d)
+	}
+	if len(d.Removed) != 0 {
+		os.Exit(1)
+	}
+}
@@ -1,9 +1,19 @@
 module github.com/magodo/usedtype
 
-go 1.15
+go 1.25.0
 
 require (
 	github.com/sirupsen/logrus v1.7.0
 	github.com/stretchr/testify v1.6.1
-	golang.org/x/tools v0.0.0-20201119191246-c0d5e8918928
+	golang.org/x/tools v0.47.0
+	golang.org/x/tools/go/pointer v0.1.0-deprecated
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/mod v0.37.0 // indirect
+	golang.org/x/sync v0.21.0 // indirect
+	golang.org/x/sys v0.46.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
@@ -1,58 +1,387 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"go/types"
 	"os"
 	"regexp"
 	"runtime"
+	"strings"
 
 	"github.com/magodo/usedtype/usedtype"
+	"golang.org/x/tools/go/callgraph"
 
 	log "github.com/sirupsen/logrus"
 )
 
-const usage = `usedtype -p <def pkg pattern> [options] <search package pattern>`
+const usage = `usedtype -p <def pkg pattern> [options] <search package pattern>
+usedtype diff [-p <def pkg pattern> [options]] <old result file|package dir> <new result file|package dir>
+usedtype query -p <def pkg pattern> [options] <Type>.<Field>[.<Field>...] <search package pattern>
+
+The "diff" subcommand compares two results, which are either the files saved by "-format json", or the package
+directories to analyze (with "./..." as the search package pattern, "-p" is required in this case). It exits with
+code 1 if any field stops being used.
+
+The "query" subcommand prints the access points of each field along the given field path, together with their
+reachability from each allocation of the root type. The type is specified by its full name or its package name
+qualified name (e.g. "armcompute.VirtualMachine"), each field is specified by either its name or its JSON tag name.`
 
 var pattern = flag.String("p", "", "The regexp pattern of import path of the package where the named types are defined.")
 var debug = flag.Bool("d", false, "Whether to show debug log")
 var verbose = flag.Bool("v", false, "Whether to output the lines of code for each field usage")
+var access = flag.String("access", "", `Only take the field usages of the given access kinds (comma separated) into account, can be any of: "read", "write", "read-modify-write", "address-escaped", "implicit"`)
+var roots = flag.String("roots", "alloc,make-interface", `The kinds of values (comma separated) of the named types that are regarded as roots, can be any of: "alloc", "make-interface", "call-result", "parameter", "global", "deref", "type-assert", "all"`)
+var dominance = flag.Bool("dominance", false, "Whether to only take the field usages that are executed on every path after the root (or the other way around) into account, rather than on some path, in the callgraph based analysis (requires -callgraph)")
+var valueFlow = flag.Bool("valueflow", false, "Whether to only take the field usages on the same instance as the root into account, based on the value flow (def-use chains) of the program")
+var pointsTo = flag.Bool("pointsto", false, "Whether to only take the field usages on the same instance as the root into account, based on the pointer analysis (expensive, requires a whole program)")
+var jobs = flag.Int("j", 0, "The maximum number of named types to build the full usages for concurrently (default to GOMAXPROCS)")
+var crossPkg = flag.String("cross-pkg", "", "The regexp pattern of import path of the packages, into which the calls are followed when searching the field usages in each package, the call stacks are output in verbose mode (default to search each package on its own)")
+var followFuncResults = flag.Bool("follow-func-results", false, `Whether to follow the fields of function types to the structures returned by the functions, shown as "Field [func result]"`)
+var collapseEmbedded = flag.Bool("collapse-embedded", false, `Whether to collapse the fields of the embedded structures into the outer structure, shown as "Field (via Embedded)"`)
+var generic = flag.String("generic", string(usedtype.GenericModeInstance), fmt.Sprintf(`How to report the instantiated generic types, can be one of: "%s" (each instantiation, e.g. "Page[VirtualMachine]"), "%s" (merged by the generic origin, e.g. "Page[T any]")`, usedtype.GenericModeInstance, usedtype.GenericModeOrigin))
+var implicit = flag.Bool("implicit", false, `Whether to also take the fields accessed implicitly into account, i.e. the fields visible to the encoding/json, encoding/xml and gopkg.in/yaml (un)marshalers and the reflect FieldByName calls with a constant name, shown as the "implicit" access`)
+var implicitFuncs = flag.String("implicit-funcs", "", `A comma separated list of the extra functions that access the fields of an argument implicitly (requires -implicit), each in form of "<pkg path>:<name>:<arg index>[:<tag>]", e.g. "github.com/mitchellh/mapstructure:Decode:1:mapstructure"`)
+var includeUnexported = flag.Bool("include-unexported", false, "Whether to also take the unexported fields into account, whose usages are only searched in the package that defines the structure")
+var unused = flag.Bool("unused", false, "Whether to output the unused fields of the named types, instead of the used ones (only text format is supported). A field is regarded as used once it is accessed anywhere, regardless of the call graph, value flow and points-to analysis")
+var coverage = flag.Bool("coverage", false, "Whether to output the field coverage summary of the named types next to the tree output (in the \"coverage\" of the json output). A field is regarded as used once it is accessed anywhere, regardless of the call graph, value flow and points-to analysis")
+var format = flag.String("format", "text", `The output format, can be one of: "text", "json"`)
+var tags = flag.String("tags", "", "A comma separated list of build tags to load the packages with")
+var tests = flag.Bool("tests", false, "Whether to also load the test packages")
+var goos = flag.String("goos", "", "A comma separated list of GOOS to load the packages with, the results of each of them are merged (default to the host one)")
+var goarch = flag.String("goarch", "", "A comma separated list of GOARCH to load the packages with, the results of each of them are merged (default to the host one)")
+var bestEffort = flag.Bool("best-effort", false, "Whether to skip the packages that contain errors, rather than aborting (the skipped packages are reported in the json output)")
+var timeout = flag.Duration("timeout", 0, "The timeout of the whole analysis, e.g. \"10m\" (default to no timeout). If it expires while building the full usages, the ones that have been built are output, and the exit code is non-zero")
 var callGraphType = flag.String("callgraph", "",
 	fmt.Sprintf(`Whether to enable callgraph based analysis, can be one of: "%[1]s", "%[2]s", "%[3]s", "%[4]s", "%[5]s"
 (Note that %[4]s and %[5]s require a whole program (main or test), and include only functions reachable from main)`,
 		usedtype.CallGraphTypeNA, usedtype.CallGraphTypeStatic, usedtype.CallGraphTypeCha, usedtype.CallGraphTypeRta, usedtype.CallGraphTypePta))
 
 func main() {
-	log.Infof("Building packages (callgraph type: %s)...\n", *callGraphType)
-	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(".", flag.Args(), usedtype.CallGraphType(*callGraphType))
+	var subcommand string
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "diff" || args[0] == "query") {
+		subcommand, args = args[0], args[1:]
+	}
+	parseFlags(subcommand, args)
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	switch subcommand {
+	case "diff":
+		runDiff(ctx, flag.Args())
+	case "query":
+		runQuery(ctx, flag.Args())
+	default:
+		run(ctx, flag.Args())
+	}
+	if interrupted {
+		os.Exit(1)
+	}
+}
+
+// interrupted is set if the build of the struct full usages is interrupted (e.g. by the timeout), whose partial
+// results are still output, but the process exits with a non-zero code.
+var interrupted bool
+
+// loadOptions returns the build configurations specified by the flags, as the cross product of the GOOS and GOARCH
+// lists.
+func loadOptions() []*usedtype.LoadOptions {
+	var tagList []string
+	if *tags != "" {
+		tagList = strings.Split(*tags, ",")
+	}
+	var opts []*usedtype.LoadOptions
+	for _, goos := range strings.Split(*goos, ",") {
+		for _, goarch := range strings.Split(*goarch, ",") {
+			opts = append(opts, &usedtype.LoadOptions{
+				Tags:       tagList,
+				Tests:      *tests,
+				GOOS:       goos,
+				GOARCH:     goarch,
+				BestEffort: *bestEffort,
+			})
+		}
+	}
+	return opts
+}
+
+// analyze builds the packages matched by the patterns (relative to dir), and finds the target named type allocations
+// and the structure direct usages in them, together with the option to build the struct full usages. If there are
+// multiple build configurations, the results of each of them are merged.
+func analyze(ctx context.Context, dir string, patterns []string) (usedtype.NamedTypeAllocSet, usedtype.StructDirectUsageMap, *usedtype.StructFullBuildOption, *usedtype.LoadReport) {
+	var (
+		rootSets   []usedtype.NamedTypeAllocSet
+		dms        []usedtype.StructDirectUsageMap
+		graphs     []*callgraph.Graph
+		valueFlows []*usedtype.ValueFlowGraph
+		ptss       []*usedtype.PointsTo
+		report     = &usedtype.LoadReport{SkippedPackages: []usedtype.SkippedPackage{}}
+	)
+	rootKinds, err := usedtype.ParseRootKind(*roots)
 	if err != nil {
 		log.Fatal(err)
 	}
+	genericMode := usedtype.GenericMode(*generic)
+	if genericMode != usedtype.GenericModeInstance && genericMode != usedtype.GenericModeOrigin {
+		log.Fatalf("invalid generic mode: %s", *generic)
+	}
+	// The context is shared by all the build configurations, whose instantiations never collide as they have
+	// different generic origins.
+	genericContext := usedtype.NewGenericContext()
+	directUsageOpt := &usedtype.StructDirectUsageOption{IncludeUnexported: *includeUnexported, Generic: genericMode, GenericContext: genericContext}
+	if *implicit {
+		directUsageOpt.ImplicitUsage = usedtype.DefaultImplicitUsageModel()
+		if *implicitFuncs != "" {
+			for _, s := range strings.Split(*implicitFuncs, ",") {
+				f, err := usedtype.ParseImplicitUsageFunc(strings.TrimSpace(s))
+				if err != nil {
+					log.Fatal(err)
+				}
+				directUsageOpt.ImplicitUsage.Funcs = append(directUsageOpt.ImplicitUsage.Funcs, f)
+			}
+		}
+	}
+	if *crossPkg != "" {
+		p, err := regexp.Compile(*crossPkg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		directUsageOpt.CrossPackage = p
+	}
+	cgType := usedtype.CallGraphType(*callGraphType)
+	if *pointsTo && cgType == usedtype.CallGraphTypePta {
+		// The call graph is built by the pointer analysis below.
+		cgType = usedtype.CallGraphTypeNA
+	}
+	for _, opt := range loadOptions() {
+		log.Infof("Building packages (callgraph type: %s, build configuration: %s)...\n", *callGraphType, opt)
+		pkgs, ssapkgs, graph, loadReport, err := usedtype.BuildPackagesContext(ctx, dir, patterns, cgType, opt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, skipped := range loadReport.SkippedPackages {
+			log.Warnf("Skipping package %s (build configuration: %s): %s", skipped.PkgPath, skipped.BuildConfiguration, strings.Join(skipped.Errors, "; "))
+		}
+		report.SkippedPackages = append(report.SkippedPackages, loadReport.SkippedPackages...)
+
+		log.Infof("Finding package named type...")
+		targetNamedTypeAllocSet, err := usedtype.FindNamedTypeAllocSetInPackageContext(ctx, pkgs, ssapkgs, regexp.MustCompile(*pattern), nil, &usedtype.NamedTypeAllocSetOption{RootKinds: rootKinds, Generic: genericMode, GenericContext: genericContext})
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Finding in-package structure direct usages...")
+		directUsage, err := usedtype.FindInPackageStructureDirectUsageContext(ctx, pkgs, ssapkgs, directUsageOpt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *access != "" {
+			kinds, err := usedtype.ParseAccessKinds(*access)
+			if err != nil {
+				log.Fatal(err)
+			}
+			directUsage = directUsage.FilterByAccessKind(kinds...)
+		}
+
+		if *pointsTo && len(ssapkgs) != 0 {
+			log.Infof("Running pointer analysis...")
+			pts, err := usedtype.AnalyzePointsToContext(ctx, ssapkgs[0].Prog, targetNamedTypeAllocSet, directUsage)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if usedtype.CallGraphType(*callGraphType) == usedtype.CallGraphTypePta {
+				graph = pts.CallGraph
+			}
+			ptss = append(ptss, pts)
+		}
+
+		rootSets = append(rootSets, targetNamedTypeAllocSet)
+		dms = append(dms, directUsage)
+		graphs = append(graphs, graph)
+		if *valueFlow && len(ssapkgs) != 0 {
+			log.Infof("Building value flow graph...")
+			vfg, err := usedtype.NewValueFlowGraphContext(ctx, ssapkgs[0].Prog, graph)
+			if err != nil {
+				log.Fatal(err)
+			}
+			valueFlows = append(valueFlows, vfg)
+		}
+	}
+
+	if len(rootSets) == 1 {
+		return rootSets[0], dms[0], buildOption(graphs[0], valueFlows, ptss, genericContext), report
+	}
+	log.Infof("Merging results of %d build configurations...", len(rootSets))
+	rootSet, dm, graph := usedtype.MergeBuildResults(rootSets, dms, graphs)
+	return rootSet, dm, buildOption(graph, valueFlows, ptss, genericContext), report
+}
+
+func buildOption(graph *callgraph.Graph, valueFlows []*usedtype.ValueFlowGraph, ptss []*usedtype.PointsTo, genericContext *types.Context) *usedtype.StructFullBuildOption {
+	opt := &usedtype.StructFullBuildOption{
+		Callgraph:             graph,
+		Dominance:             *dominance,
+		RecordAllAccessPoints: *verbose,
+		CollapseEmbedded:      *collapseEmbedded,
+		FollowFuncResults:     *followFuncResults,
+		Generic:               usedtype.GenericMode(*generic),
+		GenericContext:        genericContext,
+		IncludeUnexported:     *includeUnexported,
+		Concurrency:           *jobs,
+		Progress:              newProgressPrinter(os.Stderr),
+	}
+	if *valueFlow {
+		// In case there is no package built at all, use an empty value flow graph so that nothing is regarded as used.
+		opt.ValueFlow = usedtype.MergeValueFlowGraphs(valueFlows...)
+		if opt.ValueFlow == nil {
+			opt.ValueFlow = &usedtype.ValueFlowGraph{}
+		}
+	}
+	if pts := usedtype.MergePointsTo(ptss...); pts != nil {
+		if n := len(pts.UnresolvedRoots); n != 0 {
+			log.Warnf("%d roots have no points-to information, they are linked to the field accesses by type", n)
+			for _, alloc := range pts.UnresolvedRoots {
+				log.Debugf("No points-to information for root: %s", alloc.Position)
+			}
+		}
+		if n := len(pts.UnresolvedAccessPoints); n != 0 {
+			log.Warnf("%d field accesses have no points-to information, they are linked to the roots by type", n)
+			for _, vap := range pts.UnresolvedAccessPoints {
+				log.Debugf("No points-to information for field access: %s", vap.Pos)
+			}
+		}
+		opt.PointsTo = pts
+	}
+	return opt
+}
 
-	usedtype.SetStructFieldUsageVerbose(*verbose)
+// renderOption returns the option to render the struct full usages, as specified by the flags.
+func renderOption() *usedtype.StructFullRenderOption {
+	return &usedtype.StructFullRenderOption{Verbose: *verbose}
+}
 
-	log.Infof("Finding package named type...")
-	targetNamedTypeAllocSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile(*pattern), nil)
-	log.Infof("Finding in-package structure direct usages...")
-	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+// newProgressPrinter returns a StructFullBuildProgress that prints the progress line to w. If w is a terminal, the line
+// is updated in place. Otherwise, a new line is printed for each update.
+func newProgressPrinter(w *os.File) usedtype.StructFullBuildProgress {
+	isTerminal := false
+	if fi, err := w.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		isTerminal = true
+	}
+	return func(done, total int, current *types.Named) {
+		line := fmt.Sprintf("[%d/%d] %s", done, total, current.String())
+		if !isTerminal {
+			fmt.Fprintln(w, line)
+			return
+		}
+		// Clear the rest of the previous line.
+		fmt.Fprintf(w, "\r%s\x1b[K", line)
+		if done == total {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func buildStructFullUsages(ctx context.Context, targetNamedTypeAllocSet usedtype.NamedTypeAllocSet, directUsage usedtype.StructDirectUsageMap, opt *usedtype.StructFullBuildOption) usedtype.StructFullUsages {
 	log.Infof("Building struct full usages...")
-	fus := usedtype.BuildStructFullUsages(directUsage, targetNamedTypeAllocSet,
-		&usedtype.StructFullBuildOption{
-			Callgraph: graph,
-		},
-	)
+	fus, err := usedtype.BuildStructFullUsagesContext(ctx, directUsage, targetNamedTypeAllocSet, opt)
+	if err != nil {
+		var stageErr *usedtype.StageError
+		if !errors.As(err, &stageErr) {
+			log.Fatal(err)
+		}
+		log.Errorf("%v, only the full usages of the roots that have been built are output", err)
+		interrupted = true
+		return fus
+	}
 	log.Infof("Finish building full usages")
-	fmt.Println(fus)
+	return fus
 }
 
-func init() {
+func run(ctx context.Context, patterns []string) {
+	targetNamedTypeAllocSet, directUsage, buildOpt, report := analyze(ctx, ".", patterns)
+
+	var trees usedtype.StructTrees
+	if *unused || *coverage {
+		log.Infof("Building struct trees...")
+		trees = usedtype.BuildStructTrees(directUsage, targetNamedTypeAllocSet, buildOpt)
+		log.Infof("Finish building struct trees")
+	}
+	if *unused {
+		fmt.Println(trees.Unused())
+		if *coverage {
+			fmt.Printf("\n%s\n", trees.Coverage())
+		}
+		return
+	}
+
+	fus := buildStructFullUsages(ctx, targetNamedTypeAllocSet, directUsage, buildOpt)
+
+	switch *format {
+	case "json":
+		output := fus.ToJSON(renderOption())
+		if *bestEffort {
+			output.LoadReport = report
+		}
+		if *coverage {
+			coverages := trees.Coverage().ToJSON()
+			output.Coverage = &coverages
+		}
+		b, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(b))
+	default:
+		fmt.Println(fus.Render(renderOption()))
+		if *coverage {
+			fmt.Printf("\n%s\n", trees.Coverage())
+		}
+	}
+}
+
+func parseFlags(subcommand string, args []string) {
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "%s\n", usage)
 		flag.PrintDefaults()
 	}
-	flag.Parse()
-	if *pattern == "" {
-		flag.Usage()
+	flag.CommandLine.Parse(args)
+	switch subcommand {
+	case "diff":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+	case "query":
+		if *pattern == "" || flag.NArg() < 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		if *format != "text" || *unused || *coverage {
+			fmt.Fprintf(flag.CommandLine.Output(), "the query subcommand only supports the text format, without -unused or -coverage\n")
+			os.Exit(1)
+		}
+	default:
+		if *pattern == "" {
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+	switch *format {
+	case "text":
+	case "json":
+		if *unused {
+			fmt.Fprintf(flag.CommandLine.Output(), "json format is not supported with -unused\n")
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(flag.CommandLine.Output(), "invalid output format: %s\n", *format)
 		os.Exit(1)
 	}
 
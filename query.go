@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/magodo/usedtype/usedtype"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func runQuery(ctx context.Context, args []string) {
+	query, patterns := args[0], args[1:]
+	targetNamedTypeAllocSet, directUsage, buildOpt, _ := analyze(ctx, ".", patterns)
+	results, err := usedtype.QueryStructField(directUsage, targetNamedTypeAllocSet, query, buildOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(results)
+}
@@ -0,0 +1,116 @@
+package usedtype
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/buildssa"
+)
+
+const analyzerDoc = `report the usages of the fields of named structures
+
+The usedtype analyzer gathers each virtual field access on exported fields of the named structures, which are defined
+in the packages whose import path matches the "pattern" flag. The direct usages are exported as a package fact, and
+returned as the analysis result (a StructDirectUsageMap). If the "report" flag is set, each field access is reported
+as a diagnostic.`
+
+// Analyzer is the go/analysis Analyzer of usedtype, which finds the structure direct usages per package.
+var Analyzer = &analysis.Analyzer{
+	Name:       "usedtype",
+	Doc:        analyzerDoc,
+	Requires:   []*analysis.Analyzer{buildssa.Analyzer},
+	Run:        runAnalyzer,
+	ResultType: reflect.TypeOf(StructDirectUsageMap{}),
+	FactTypes:  []analysis.Fact{new(StructDirectUsageFact)},
+}
+
+var (
+	analyzerPattern string
+	analyzerReport  bool
+)
+
+func init() {
+	Analyzer.Flags.StringVar(&analyzerPattern, "pattern", "", "The regexp pattern of import path of the package where the named types are defined (default to all)")
+	Analyzer.Flags.BoolVar(&analyzerReport, "report", false, "Whether to report each field usage as a diagnostic")
+}
+
+// StructDirectUsageFact is a package fact that records the structure direct usages in a package.
+type StructDirectUsageFact struct {
+	// Usages maps from the named structure to its used fields, each of which maps to the positions of its virtual
+	// access points.
+	Usages map[string]map[string][]string
+}
+
+func (*StructDirectUsageFact) AFact() {}
+
+func (f *StructDirectUsageFact) String() string {
+	var types []string
+	for t := range f.Usages {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	var out []string
+	for _, t := range types {
+		var fields []string
+		for field := range f.Usages[t] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		out = append(out, fmt.Sprintf("%s{%s}", t, strings.Join(fields, ", ")))
+	}
+	return "usedtype(" + strings.Join(out, "; ") + ")"
+}
+
+func runAnalyzer(pass *analysis.Pass) (interface{}, error) {
+	var p *regexp.Regexp
+	if analyzerPattern != "" {
+		var err error
+		p, err = regexp.Compile(analyzerPattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ssainput := pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA)
+
+	dm := StructDirectUsageMap{}
+	ssaTraversal := NewTraversal()
+	cb := dm.recordCallback(pass.Fset, &ssaTraversal, nil, nil)
+	ssaTraversal.WalkInPackage(ssainput.Pkg, cb, nil)
+	// The source functions contain the methods and anonymous functions that might not be reached from the members.
+	for _, fn := range ssainput.SrcFuncs {
+		ssaTraversal.walkFunction(ssainput.Pkg, fn, cb, nil)
+	}
+
+	output := StructDirectUsageMap{}
+	fact := &StructDirectUsageFact{Usages: map[string]map[string][]string{}}
+	for nt, du := range dm {
+		if p != nil && (nt.Obj().Pkg() == nil || !p.MatchString(nt.Obj().Pkg().Path())) {
+			continue
+		}
+		output[nt] = du
+
+		fields := map[string][]string{}
+		for field, vaps := range du {
+			name := field.base.Field(field.index).Name()
+			for _, vap := range vaps {
+				fields[name] = append(fields[name], vap.Pos.String())
+				// The access points whose position can't be resolved are not reported.
+				if pos := instrPos(vap.Instr); analyzerReport && pos.IsValid() {
+					pass.Reportf(pos, "%s.%s is used (%s)", nt.Obj().Name(), name, vap.Kind)
+				}
+			}
+		}
+		fact.Usages[nt.String()] = fields
+	}
+
+	if len(fact.Usages) != 0 {
+		pass.ExportPackageFact(fact)
+	}
+	return output, nil
+}
@@ -0,0 +1,23 @@
+package usedtype_test
+
+import (
+	"testing"
+
+	"github.com/magodo/usedtype/usedtype"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	require.NoError(t, usedtype.Analyzer.Flags.Set("pattern", "sdk"))
+	require.NoError(t, usedtype.Analyzer.Flags.Set("report", "true"))
+	defer func() {
+		usedtype.Analyzer.Flags.Set("pattern", "")
+		usedtype.Analyzer.Flags.Set("report", "false")
+	}()
+
+	results := analysistest.Run(t, pathTestdata, usedtype.Analyzer, "analyzer")
+	require.Len(t, results, 1)
+	dm := results[0].Result.(usedtype.StructDirectUsageMap)
+	require.Len(t, dm, 2)
+}
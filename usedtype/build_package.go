@@ -1,8 +1,14 @@
 package usedtype
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
 
 	"golang.org/x/tools/go/callgraph"
 	"golang.org/x/tools/go/callgraph/cha"
@@ -24,70 +30,288 @@ const (
 	CallGraphTypeNA                   = ""
 )
 
+// LoadOptions specifies the build configuration used to load the packages.
+type LoadOptions struct {
+	// Tags are the build tags.
+	Tags []string
+
+	// Tests indicates whether to also load the test packages (including the _test.go files). A package is only
+	// returned as its test variant then, which includes the non-test files as well.
+	Tests bool
+
+	// GOOS and GOARCH override the target operating system and architecture, if non-empty.
+	GOOS   string
+	GOARCH string
+
+	// BestEffort indicates to skip the packages that contain errors (including the ones that depend on them), rather
+	// than aborting. The skipped packages are recorded in the LoadReport.
+	BestEffort bool
+}
+
+// LoadReport records the packages that are skipped during a best effort load (see LoadOptions.BestEffort).
+type LoadReport struct {
+	SkippedPackages []SkippedPackage `json:"skipped_packages"`
+}
+
+type SkippedPackage struct {
+	PkgPath string `json:"pkg_path"`
+
+	// BuildConfiguration is the build configuration that the package is loaded with.
+	BuildConfiguration string `json:"build_configuration"`
+
+	// Errors are the errors of the package itself. It is empty if the package is skipped only because some of its
+	// dependencies contain errors.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// newLoadReport records the ill typed packages, which are either the initial packages, or the packages that contain errors.
+func newLoadReport(pkgs []*packages.Package, opt *LoadOptions) *LoadReport {
+	report := &LoadReport{SkippedPackages: []SkippedPackage{}}
+	isInitial := map[*packages.Package]bool{}
+	for _, pkg := range pkgs {
+		isInitial[pkg] = true
+	}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !pkg.IllTyped {
+			return
+		}
+		if !isInitial[pkg] && len(pkg.Errors) == 0 {
+			return
+		}
+		skipped := SkippedPackage{
+			PkgPath:            pkg.PkgPath,
+			BuildConfiguration: opt.String(),
+		}
+		for _, err := range pkg.Errors {
+			skipped.Errors = append(skipped.Errors, err.Error())
+		}
+		report.SkippedPackages = append(report.SkippedPackages, skipped)
+	})
+	return report
+}
+
+func (opt *LoadOptions) String() string {
+	if opt == nil {
+		return "default"
+	}
+	var out []string
+	if opt.GOOS != "" {
+		out = append(out, "GOOS="+opt.GOOS)
+	}
+	if opt.GOARCH != "" {
+		out = append(out, "GOARCH="+opt.GOARCH)
+	}
+	if len(opt.Tags) != 0 {
+		out = append(out, "tags="+strings.Join(opt.Tags, ","))
+	}
+	if opt.Tests {
+		out = append(out, "tests")
+	}
+	if len(out) == 0 {
+		return "default"
+	}
+	return strings.Join(out, " ")
+}
+
+func (opt *LoadOptions) packagesConfig(dir string) *packages.Config {
+	cfg := &packages.Config{Dir: dir, Mode: packages.LoadAllSyntax}
+	if opt == nil {
+		return cfg
+	}
+	cfg.Tests = opt.Tests
+	if len(opt.Tags) != 0 {
+		cfg.BuildFlags = []string{"-tags", strings.Join(opt.Tags, ",")}
+	}
+	if opt.GOOS != "" || opt.GOARCH != "" {
+		cfg.Env = os.Environ()
+		if opt.GOOS != "" {
+			cfg.Env = append(cfg.Env, "GOOS="+opt.GOOS)
+		}
+		if opt.GOARCH != "" {
+			cfg.Env = append(cfg.Env, "GOARCH="+opt.GOARCH)
+		}
+	}
+	return cfg
+}
+
 // BuildPackages accept the process argument and feed it to the packages.Load() to build
 // both packages.Package and usedtype.Package(s) with a whole program build.
+// The packages are loaded with the default build configuration, see BuildPackagesWithOptions for more control.
 func BuildPackages(dir string, args []string, callgraphType CallGraphType) ([]*packages.Package, []*ssa.Package, *callgraph.Graph, error) {
-	cfg := packages.Config{Dir: dir, Mode: packages.LoadAllSyntax}
-	pkgs, err := packages.Load(&cfg, args...)
+	pkgs, ssapkgs, graph, _, err := BuildPackagesWithOptions(dir, args, callgraphType, nil)
+	return pkgs, ssapkgs, graph, err
+}
+
+// BuildPackagesWithOptions is like BuildPackages, but loads the packages with the opt, which can be nil.
+// The returned LoadReport is never nil, it is only non-empty in best effort mode.
+func BuildPackagesWithOptions(dir string, args []string, callgraphType CallGraphType, opt *LoadOptions) ([]*packages.Package, []*ssa.Package, *callgraph.Graph, *LoadReport, error) {
+	return BuildPackagesContext(context.Background(), dir, args, callgraphType, opt)
+}
+
+// BuildPackagesContext is like BuildPackagesWithOptions, but stops once the context is done, and returns a *StageError together
+// with the partial results: the loaded packages if interrupted while building SSA, and additionally the SSA packages
+// if interrupted while building the call graph. Note that the call graph algorithms can't be cancelled, they are
+// left running to completion in the background when the context is done.
+func BuildPackagesContext(ctx context.Context, dir string, args []string, callgraphType CallGraphType, opt *LoadOptions) ([]*packages.Package, []*ssa.Package, *callgraph.Graph, *LoadReport, error) {
+	if err := checkStage(ctx, StageLoadPackages); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	cfg := opt.packagesConfig(dir)
+	cfg.Context = ctx
+	pkgs, err := packages.Load(cfg, args...)
 	if err != nil {
-		return nil, nil, nil, err
+		if ctxErr := checkStage(ctx, StageLoadPackages); ctxErr != nil {
+			return nil, nil, nil, nil, ctxErr
+		}
+		return nil, nil, nil, nil, err
 	}
 
-	// Stop if any package had errors.
-	// This step is optional; without it, the previous step
-	// will create SSA for only a subset of packages.
-	if packages.PrintErrors(pkgs) > 0 {
-		return nil, nil, nil, errors.New("packages contain errors")
+	report := &LoadReport{SkippedPackages: []SkippedPackage{}}
+	if opt != nil && opt.BestEffort {
+		report = newLoadReport(pkgs, opt)
+	} else {
+		// Stop if any package had errors.
+		// This step is optional; without it, the previous step
+		// will create SSA for only a subset of packages.
+		if packages.PrintErrors(pkgs) > 0 {
+			return nil, nil, nil, nil, errors.New("packages contain errors")
+		}
 	}
 
 	// Build SSA for the specified "pkgs" and their dependencies.
 	// The returned ssapkgs is the corresponding SSA Package of the specified "pkgs".
+	// In best effort mode, the ill typed packages have no SSA package built, they are removed from the result.
 	prog, ssapkgs := ssautil.AllPackages(pkgs, 0)
-	prog.Build()
+	if err := buildProgram(ctx, prog); err != nil {
+		return pkgs, nil, nil, report, err
+	}
+	if opt != nil && opt.BestEffort {
+		var wellTypedPkgs []*packages.Package
+		var wellTypedSSAPkgs []*ssa.Package
+		for i := range ssapkgs {
+			if ssapkgs[i] == nil {
+				continue
+			}
+			wellTypedPkgs = append(wellTypedPkgs, pkgs[i])
+			wellTypedSSAPkgs = append(wellTypedSSAPkgs, ssapkgs[i])
+		}
+		pkgs, ssapkgs = wellTypedPkgs, wellTypedSSAPkgs
+	}
+	if opt != nil && opt.Tests {
+		pkgs, ssapkgs = skipTestedPackages(pkgs, ssapkgs)
+	}
 
 	// Build Callgraph
 	var graph *callgraph.Graph
+	var buildGraph func() error
 	switch callgraphType {
 	case CallGraphTypeStatic:
-		graph = static.CallGraph(prog)
+		buildGraph = func() error {
+			graph = static.CallGraph(prog)
+			return nil
+		}
 	case CallGraphTypeCha:
-		graph = cha.CallGraph(prog)
+		buildGraph = func() error {
+			graph = cha.CallGraph(prog)
+			return nil
+		}
 	case CallGraphTypeRta:
 		mains, err := mainPackages(prog.AllPackages())
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 		var roots []*ssa.Function
 		for _, main := range mains {
 			roots = append(roots, main.Func("init"), main.Func("main"))
 		}
-		rtares := rta.Analyze(roots, true)
-		graph = rtares.CallGraph
+		buildGraph = func() error {
+			rtares := rta.Analyze(roots, true)
+			graph = rtares.CallGraph
+			return nil
+		}
 	case CallGraphTypePta:
 		mains, err := mainPackages(prog.AllPackages())
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 		config := &pointer.Config{
 			Mains:          mains,
 			BuildCallGraph: true,
 		}
-		ptares, err := pointer.Analyze(config)
-		if err != nil {
-			return nil, nil, nil, err
+		buildGraph = func() error {
+			ptares, err := pointerAnalyze(config)
+			if err != nil {
+				// The pointer analysis fails on the unsupported types (e.g. the type aliases).
+				log.Warnf("Pointer analysis failed, falling back to the CHA call graph: %v", err)
+				graph = cha.CallGraph(prog)
+				return nil
+			}
+			graph = ptares.CallGraph
+			return nil
 		}
-		graph = ptares.CallGraph
 	case CallGraphTypeNA:
 		// do nothing
 	default:
-		return nil, nil, nil, fmt.Errorf("invalid call graph type: %s", callgraphType)
+		return nil, nil, nil, nil, fmt.Errorf("invalid call graph type: %s", callgraphType)
+	}
+
+	if buildGraph != nil {
+		var buildErr error
+		if err := runStage(ctx, StageBuildCallGraph, func() { buildErr = buildGraph() }); err != nil {
+			return pkgs, ssapkgs, nil, report, err
+		}
+		if buildErr != nil {
+			return nil, nil, nil, nil, buildErr
+		}
 	}
 
-	return pkgs, ssapkgs, graph, nil
+	return pkgs, ssapkgs, graph, report, nil
+}
+
+// buildProgram builds the SSA of all the packages in the program concurrently (like ssa.Program.Build), but stops
+// building the packages that haven't started once the context is done.
+func buildProgram(ctx context.Context, prog *ssa.Program) error {
+	var wg sync.WaitGroup
+	for _, p := range prog.AllPackages() {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(p *ssa.Package) {
+			defer wg.Done()
+			if ctx.Err() != nil {
+				return
+			}
+			p.Build()
+		}(p)
+	}
+	wg.Wait()
+	return checkStage(ctx, StageBuildSSA)
 }
 
 // mainPackages returns the main packages to analyze.
 // Each resulting package is named "main" and has a main function.
+// skipTestedPackages removes the packages whose test variant (i.e. "p [p.test]") is also loaded. The test variant
+// includes all the files of the package, the usages in the non-test files would otherwise be found once per variant.
+func skipTestedPackages(pkgs []*packages.Package, ssapkgs []*ssa.Package) ([]*packages.Package, []*ssa.Package) {
+	tested := map[string]bool{}
+	for _, pkg := range pkgs {
+		if pkg.ID == fmt.Sprintf("%[1]s [%[1]s.test]", pkg.PkgPath) {
+			tested[pkg.PkgPath] = true
+		}
+	}
+	var outPkgs []*packages.Package
+	var outSSAPkgs []*ssa.Package
+	for i, pkg := range pkgs {
+		if pkg.ID == pkg.PkgPath && tested[pkg.PkgPath] {
+			continue
+		}
+		outPkgs = append(outPkgs, pkg)
+		outSSAPkgs = append(outSSAPkgs, ssapkgs[i])
+	}
+	return outPkgs, outSSAPkgs
+}
+
 func mainPackages(pkgs []*ssa.Package) ([]*ssa.Package, error) {
 	var mains []*ssa.Package
 	for _, p := range pkgs {
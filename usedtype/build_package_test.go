@@ -0,0 +1,149 @@
+package usedtype_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/magodo/usedtype/usedtype"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/callgraph"
+)
+
+func TestBuildPackagesWithLoadOptions(t *testing.T) {
+	cases := []struct {
+		opts   []*usedtype.LoadOptions
+		expect string
+	}{
+		// 0
+		{
+			[]*usedtype.LoadOptions{{GOOS: "linux"}},
+			`
+sdk.ModelA
+    String (string)
+    ArrayOfString (array_of_string)
+`,
+		},
+		// 1
+		{
+			[]*usedtype.LoadOptions{{Tags: []string{"foo"}, Tests: true, GOOS: "linux"}},
+			`
+sdk.ModelA
+    String (string)
+    Property (property)
+        Int (int)
+    PointerOfProperty (pointer_of_property)
+        Int (int)
+    ArrayOfString (array_of_string)
+`,
+		},
+		// 2
+		{
+			[]*usedtype.LoadOptions{{GOOS: "linux"}, {GOOS: "windows"}},
+			`
+sdk.ModelA
+    String (string)
+    ArrayOfString (array_of_string)
+    PointerOfArrayOfString (pointer_of_array_of_string)
+`,
+		},
+	}
+
+	for idx, c := range cases {
+		var (
+			rootSets []usedtype.NamedTypeAllocSet
+			dms      []usedtype.StructDirectUsageMap
+			graphs   []*callgraph.Graph
+		)
+		for _, opt := range c.opts {
+			pkgs, ssapkgs, graph, _, err := usedtype.BuildPackagesWithOptions(pathLoadOptions, []string{"."}, usedtype.CallGraphTypeNA, opt)
+			require.NoError(t, err, idx)
+			rootSets = append(rootSets, usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA")))
+			dms = append(dms, usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs))
+			graphs = append(graphs, graph)
+		}
+		rootSet, dm, graph := usedtype.MergeBuildResults(rootSets, dms, graphs)
+		fus := usedtype.BuildStructFullUsages(dm, rootSet, &usedtype.StructFullBuildOption{Callgraph: graph})
+		require.Equal(t, c.expect, "\n"+fus.String()+"\n", idx)
+	}
+}
+
+func TestBuildPackagesWithTests(t *testing.T) {
+	pkgs, ssapkgs, _, _, err := usedtype.BuildPackagesWithOptions(pathLoadOptions, []string{"."}, usedtype.CallGraphTypeNA, &usedtype.LoadOptions{Tests: true, GOOS: "linux"})
+	require.NoError(t, err)
+
+	// The usages in the non-test files are only found in the test variant of the package, rather than once per variant.
+	dm := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	var actual []string
+	for _, ap := range accessPoints(dm, func(vap usedtype.VirtAccessPoint) string {
+		return fmt.Sprintf("%s:%d:%d", filepath.Base(vap.Pos.Filename), vap.Pos.Line, vap.Pos.Column)
+	}) {
+		if strings.HasPrefix(ap, "sdk.") {
+			actual = append(actual, ap)
+		}
+	}
+	require.Equal(t, []string{
+		"sdk.ModelA.ArrayOfString (array_of_string): main_linux.go:8:6",
+		"sdk.ModelA.PointerOfProperty (pointer_of_property): main_test.go:11:20",
+		"sdk.ModelA.String (string): main.go:9:9",
+	}, actual)
+}
+
+func TestBuildPackagesBestEffort(t *testing.T) {
+	_, _, _, err := usedtype.BuildPackages(pathBestEffort, []string{"./..."}, usedtype.CallGraphTypeNA)
+	require.Error(t, err)
+
+	pkgs, ssapkgs, _, report, err := usedtype.BuildPackagesWithOptions(pathBestEffort, []string{"./..."}, usedtype.CallGraphTypeNA, &usedtype.LoadOptions{BestEffort: true})
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	require.Len(t, ssapkgs, 1)
+
+	require.Len(t, report.SkippedPackages, 2)
+	skipped := map[string]usedtype.SkippedPackage{}
+	for _, pkg := range report.SkippedPackages {
+		skipped[pkg.PkgPath] = pkg
+	}
+	require.Len(t, skipped["best_effort/broken"].Errors, 1)
+	require.Contains(t, skipped["best_effort/broken"].Errors[0], "undefined")
+	require.Len(t, skipped["best_effort/dependent"].Errors, 0)
+
+	// Only the usage in the well typed package is found.
+	dm := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	require.Len(t, dm, 1)
+	for _, du := range dm {
+		require.Len(t, du, 1)
+	}
+}
+
+func TestAnalysisContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, _, _, err := usedtype.BuildPackagesContext(ctx, pathCrossFunc, []string{"."}, usedtype.CallGraphTypeStatic, nil)
+	var stageErr *usedtype.StageError
+	require.True(t, errors.As(err, &stageErr))
+	require.Equal(t, usedtype.StageLoadPackages, stageErr.Stage)
+	require.True(t, errors.Is(err, context.Canceled))
+
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathCrossFunc, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), nil)
+	fus, err := usedtype.BuildStructFullUsagesContext(ctx, directUsage, targetRootSet, &usedtype.StructFullBuildOption{Callgraph: graph})
+	require.True(t, errors.As(err, &stageErr))
+	require.Equal(t, usedtype.StageBuildFullUsages, stageErr.Stage)
+	require.Empty(t, fus.UsagesAmongAlloc)
+
+	// The stages that can't be cancelled are not started.
+	_, err = usedtype.AnalyzePointsToContext(ctx, ssapkgs[0].Prog, targetRootSet, directUsage)
+	require.True(t, errors.As(err, &stageErr))
+	require.Equal(t, usedtype.StageAnalyzePointsTo, stageErr.Stage)
+
+	_, err = usedtype.NewValueFlowGraphContext(ctx, ssapkgs[0].Prog, graph)
+	require.True(t, errors.As(err, &stageErr))
+	require.Equal(t, usedtype.StageBuildValueFlow, stageErr.Stage)
+}
@@ -0,0 +1,39 @@
+package usedtype
+
+import (
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/pointer"
+	"golang.org/x/tools/go/ssa"
+)
+
+// ReachabilityIndex exposes the reachabilityIndex to the tests.
+type ReachabilityIndex struct {
+	idx *reachabilityIndex
+}
+
+func NewReachabilityIndex(graph *callgraph.Graph, cacheSize int) *ReachabilityIndex {
+	return &ReachabilityIndex{idx: newReachabilityIndexOf(graph, cacheSize)}
+}
+
+func (r *ReachabilityIndex) SameSCC(f1, f2 *ssa.Function) bool {
+	c1, ok1 := r.idx.scc[r.idx.graph.Nodes[f1]]
+	c2, ok2 := r.idx.scc[r.idx.graph.Nodes[f2]]
+	return ok1 && ok2 && c1 == c2
+}
+
+func (r *ReachabilityIndex) CanReach(from, to *ssa.Function) bool {
+	return r.idx.canReach(r.idx.graph.Nodes[from], r.idx.graph.Nodes[to])
+}
+
+func (r *ReachabilityIndex) Cached() int {
+	r.idx.mu.RLock()
+	defer r.idx.mu.RUnlock()
+	return len(r.idx.reach)
+}
+
+// SetPointerAnalyze replaces the pointer analysis, it returns a function to restore the original one.
+func SetPointerAnalyze(f func(config *pointer.Config) (*pointer.Result, error)) (restore func()) {
+	orig := pointerAnalyze
+	pointerAnalyze = f
+	return func() { pointerAnalyze = orig }
+}
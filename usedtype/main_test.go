@@ -9,6 +9,7 @@ import (
 )
 
 var (
+	pathTestdata                    string
 	pathA                           string
 	pathInterfaceProperty           string
 	pathInterfaceRoot               string
@@ -18,11 +19,32 @@ var (
 	pathCrossBB                     string
 	pathCrossFuncNoLink             string
 	pathInstrPos                    string
+	pathInstrPosFallback            string
 	pathInitMethod                  string
+	pathAccessKind                  string
+	pathLoadOptions                 string
+	pathBestEffort                  string
+	pathRootKind                    string
+	pathValueFlow                   string
+	pathValueFlowElem               string
+	pathReachability                string
+	pathDominance                   string
+	pathCrossPackage                string
+	pathCrossPackageDiamond         string
+	pathGlobalRoot                  string
+	pathEmbedded                    string
+	pathUnexported                  string
+	pathContainer                   string
+	pathGeneric                     string
+	pathImplicit                    string
+	pathImplicitFlow                string
+	pathPointerFallback             string
+	pathReachabilityIndex           string
 )
 
 func init() {
 	pwd, _ := os.Getwd()
+	pathTestdata = filepath.Join(pwd, "testdata")
 	pathA = filepath.Join(pwd, "testdata", "src", "a")
 	pathInterfaceProperty = filepath.Join(pwd, "testdata", "src", "interface_property")
 	pathInterfaceRoot = filepath.Join(pwd, "testdata", "src", "interface_root")
@@ -32,7 +54,27 @@ func init() {
 	pathCrossBB = filepath.Join(pwd, "testdata", "src", "cross_bb")
 	pathCrossFuncNoLink = filepath.Join(pwd, "testdata", "src", "cross_func_no_link")
 	pathInstrPos = filepath.Join(pwd, "testdata", "src", "instr_pos")
+	pathInstrPosFallback = filepath.Join(pwd, "testdata", "src", "instr_pos_fallback")
 	pathInitMethod = filepath.Join(pwd, "testdata", "src", "init_method")
+	pathAccessKind = filepath.Join(pwd, "testdata", "src", "access_kind")
+	pathLoadOptions = filepath.Join(pwd, "testdata", "src", "load_options")
+	pathBestEffort = filepath.Join(pwd, "testdata", "src", "best_effort")
+	pathRootKind = filepath.Join(pwd, "testdata", "src", "root_kind")
+	pathValueFlow = filepath.Join(pwd, "testdata", "src", "value_flow")
+	pathValueFlowElem = filepath.Join(pwd, "testdata", "src", "value_flow_elem")
+	pathReachability = filepath.Join(pwd, "testdata", "src", "reachability")
+	pathDominance = filepath.Join(pwd, "testdata", "src", "dominance")
+	pathCrossPackage = filepath.Join(pwd, "testdata", "src", "cross_package")
+	pathCrossPackageDiamond = filepath.Join(pwd, "testdata", "src", "cross_package_diamond")
+	pathGlobalRoot = filepath.Join(pwd, "testdata", "src", "global_root")
+	pathEmbedded = filepath.Join(pwd, "testdata", "src", "embedded")
+	pathUnexported = filepath.Join(pwd, "testdata", "src", "unexported")
+	pathContainer = filepath.Join(pwd, "testdata", "src", "container")
+	pathGeneric = filepath.Join(pwd, "testdata", "src", "generic")
+	pathImplicit = filepath.Join(pwd, "testdata", "src", "implicit")
+	pathImplicitFlow = filepath.Join(pwd, "testdata", "src", "implicit_flow")
+	pathPointerFallback = filepath.Join(pwd, "testdata", "src", "pointer_fallback")
+	pathReachabilityIndex = filepath.Join(pwd, "testdata", "src", "reachability_index")
 }
 
 func filterTypeByName(typeName string) func(epkg *packages.Package, t *types.Named) bool {
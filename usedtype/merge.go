@@ -0,0 +1,112 @@
+package usedtype
+
+import (
+	"go/types"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// namedTypeCanonicalizer maps the Named types from different programs (e.g. the ones loaded with different build
+// configurations) to a canonical one, identified by the full name of the type. The first seen one is the canonical one.
+type namedTypeCanonicalizer map[string]*types.Named
+
+func (c namedTypeCanonicalizer) canonical(nt *types.Named) *types.Named {
+	if nt == nil {
+		return nil
+	}
+	if cnt, ok := c[nt.String()]; ok {
+		return cnt
+	}
+	c[nt.String()] = nt
+	return nt
+}
+
+// structField maps a field of the Named structure "owner" to the same named field of the canonical owner. In case the
+// canonical owner has no such field (e.g. the field is only defined for some build configuration), the field is
+// returned as is.
+func (c namedTypeCanonicalizer) structField(owner *types.Named, field StructField) StructField {
+	cowner := c.canonical(owner)
+	if cowner == owner {
+		return field
+	}
+	cst, ok := cowner.Underlying().(*types.Struct)
+	if !ok {
+		return field
+	}
+	name := field.base.Field(field.index).Name()
+	if field.index < cst.NumFields() && cst.Field(field.index).Name() == name {
+		return StructField{base: cst, index: field.index}
+	}
+	for i := 0; i < cst.NumFields(); i++ {
+		if cst.Field(i).Name() == name {
+			return StructField{base: cst, index: i}
+		}
+	}
+	return field
+}
+
+func (s NamedTypeAllocSet) mergeInto(c namedTypeCanonicalizer, out NamedTypeAllocSet) {
+	for nt, allocSet := range s {
+		cnt := c.canonical(nt)
+		aset, ok := out[cnt]
+		if !ok {
+			aset = AllocSet{}
+			out[cnt] = aset
+		}
+		for alloc := range allocSet {
+			aset[alloc] = struct{}{}
+		}
+	}
+}
+
+func (m StructDirectUsageMap) mergeInto(c namedTypeCanonicalizer, out StructDirectUsageMap) {
+	for nt, du := range m {
+		cnt := c.canonical(nt)
+		if len(out[cnt]) == 0 {
+			out[cnt] = map[StructField][]VirtAccessPoint{}
+		}
+		for field, vaps := range du {
+			cfield := c.structField(nt, field)
+			out[cnt][cfield] = append(out[cnt][cfield], vaps...)
+		}
+	}
+}
+
+// MergeBuildResults merges the named type alloc sets, the structure direct usages and the call graphs, which are
+// found in the same packages but loaded with different build configurations (see LoadOptions). The merged results can
+// be used to build the struct full usages as a whole.
+// The Named types from different build configurations are identified by their full names.
+// As each call graph only covers the functions of its own program, the allocations and the field accesses from
+// different build configurations are never regarded as reachable to each other.
+func MergeBuildResults(rootSets []NamedTypeAllocSet, dms []StructDirectUsageMap, graphs []*callgraph.Graph) (NamedTypeAllocSet, StructDirectUsageMap, *callgraph.Graph) {
+	c := namedTypeCanonicalizer{}
+
+	rootSet := NamedTypeAllocSet{}
+	for _, s := range rootSets {
+		s.mergeInto(c, rootSet)
+	}
+
+	dm := StructDirectUsageMap{}
+	for _, m := range dms {
+		m.mergeInto(c, dm)
+	}
+
+	var graph *callgraph.Graph
+	for _, g := range graphs {
+		if g == nil {
+			continue
+		}
+		if graph == nil {
+			graph = &callgraph.Graph{
+				Root:  g.Root,
+				Nodes: map[*ssa.Function]*callgraph.Node{},
+			}
+		}
+		for fn, n := range g.Nodes {
+			graph.Nodes[fn] = n
+		}
+	}
+
+	return rootSet, dm, graph
+}
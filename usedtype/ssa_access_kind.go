@@ -0,0 +1,187 @@
+package usedtype
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// AccessKind describes how a field is accessed at a virtual access point. It is a bit set, so that one access can be
+// both a read and a write (i.e. read-modify-write).
+type AccessKind int
+
+const (
+	AccessKindRead AccessKind = 1 << iota
+	AccessKindWrite
+	// AccessKindAddrEscaped means the address of the field is passed elsewhere (e.g. as a call argument), so that
+	// we can't tell how it is accessed then.
+	AccessKindAddrEscaped
+	// AccessKindImplicit means the field is accessed implicitly, e.g. by a decoder via reflection (see
+	// ImplicitUsageModel), so that there is no Field or FieldAddr instruction for it.
+	AccessKindImplicit
+
+	AccessKindReadModifyWrite = AccessKindRead | AccessKindWrite
+	AccessKindAll             = AccessKindRead | AccessKindWrite | AccessKindAddrEscaped | AccessKindImplicit
+)
+
+var accessKindNames = []struct {
+	kind AccessKind
+	name string
+}{
+	{AccessKindRead, "read"},
+	{AccessKindWrite, "write"},
+	{AccessKindAddrEscaped, "address-escaped"},
+	{AccessKindImplicit, "implicit"},
+}
+
+func (k AccessKind) String() string {
+	if k == AccessKindReadModifyWrite {
+		return "read-modify-write"
+	}
+	var names []string
+	for _, kn := range accessKindNames {
+		if k&kn.kind != 0 {
+			names = append(names, kn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "unknown"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseAccessKind parses a comma separated list of access kind names (i.e. "read", "write", "address-escaped",
+// "implicit" and "read-modify-write") into an AccessKind, which is the union of them.
+func ParseAccessKind(s string) (AccessKind, error) {
+	kinds, err := ParseAccessKinds(s)
+	if err != nil {
+		return 0, err
+	}
+	var kind AccessKind
+	for _, k := range kinds {
+		kind |= k
+	}
+	return kind, nil
+}
+
+// ParseAccessKinds is like ParseAccessKind, but returns each of the access kinds separately, so that a compound kind
+// (i.e. "read-modify-write") is not mixed up with its components (i.e. "read,write").
+func ParseAccessKinds(s string) ([]AccessKind, error) {
+	var kinds []AccessKind
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "read-modify-write" {
+			kinds = append(kinds, AccessKindReadModifyWrite)
+			continue
+		}
+		found := false
+		for _, kn := range accessKindNames {
+			if kn.name == name {
+				kinds = append(kinds, kn.kind)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid access kind: %s", name)
+		}
+	}
+	return kinds, nil
+}
+
+// InstrAccessKind works out how the field is accessed by a Field or FieldAddr instruction.
+// For a Field instruction, it is always a read. For a FieldAddr instruction, it is decided by the referrers of
+// the field address:
+// - Stored to: write
+// - Loaded from: read
+// - Further addressed (e.g. a nested field or an element): the access kind of that address
+// - Others (e.g. passed as call argument, stored as a value): address escaped
+func InstrAccessKind(instr ssa.Instruction) AccessKind {
+	switch instr := instr.(type) {
+	case *ssa.Field:
+		return AccessKindRead
+	case *ssa.FieldAddr:
+		kind := addrAccessKind(instr)
+		if kind == AccessKindRead || kind == AccessKindWrite {
+			if isIncDecFieldAddr(instr) {
+				return AccessKindReadModifyWrite
+			}
+		}
+		return kind
+	default:
+		return 0
+	}
+}
+
+// isIncDecFieldAddr tells whether a FieldAddr is part of a statement like "x.f++" or "x.f += 1", where SSA emits two
+// separate FieldAddr instructions, one for loading the field and the other for storing the computed value back.
+func isIncDecFieldAddr(fa *ssa.FieldAddr) bool {
+	sameField := func(v ssa.Value) bool {
+		other, ok := v.(*ssa.FieldAddr)
+		return ok && other != fa && other.X == fa.X && other.Field == fa.Field
+	}
+	loadedFromSameField := func(v ssa.Value) bool {
+		load, ok := v.(*ssa.UnOp)
+		return ok && load.Op == token.MUL && sameField(load.X)
+	}
+
+	for _, ref := range *fa.Referrers() {
+		switch ref := ref.(type) {
+		case *ssa.Store:
+			// write part: the stored value is computed from a load of the same field
+			binop, ok := ref.Val.(*ssa.BinOp)
+			if ok && (loadedFromSameField(binop.X) || loadedFromSameField(binop.Y)) {
+				return true
+			}
+		case *ssa.UnOp:
+			// read part: the loaded value is used to compute a value that is stored back to the same field
+			for _, lref := range *ref.Referrers() {
+				binop, ok := lref.(*ssa.BinOp)
+				if !ok {
+					continue
+				}
+				for _, bref := range *binop.Referrers() {
+					if store, ok := bref.(*ssa.Store); ok && store.Val == binop && sameField(store.Addr) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func addrAccessKind(addr ssa.Value) AccessKind {
+	referrers := addr.Referrers()
+	if referrers == nil {
+		return 0
+	}
+	var kind AccessKind
+	for _, ref := range *referrers {
+		switch ref := ref.(type) {
+		case *ssa.DebugRef:
+			continue
+		case *ssa.Store:
+			if ref.Addr == addr {
+				kind |= AccessKindWrite
+			} else {
+				kind |= AccessKindAddrEscaped
+			}
+		case *ssa.UnOp:
+			if ref.Op == token.MUL {
+				kind |= AccessKindRead
+			} else {
+				kind |= AccessKindAddrEscaped
+			}
+		case *ssa.FieldAddr:
+			kind |= addrAccessKind(ref)
+		case *ssa.IndexAddr:
+			kind |= addrAccessKind(ref)
+		default:
+			kind |= AccessKindAddrEscaped
+		}
+	}
+	return kind
+}
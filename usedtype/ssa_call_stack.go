@@ -0,0 +1,87 @@
+package usedtype
+
+import (
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// CallStack is the chain of the call sites through which an instruction is reached during a cross package traversal
+// (see NewCrossPackageTraversal). Each CallStack is a frame that links to its caller frame, so that the common prefix
+// is shared among the call stacks. A nil CallStack is an empty one.
+// The frames are interned per traversal, so that the equal call stacks are the same pointer.
+type CallStack struct {
+	// Caller is the frame of the outer call site, or nil if this is the outermost one.
+	Caller *CallStack
+	Site   ssa.CallInstruction
+	Pos    token.Position
+
+	// n is the number of the frames, including this one.
+	n int
+}
+
+// callFrameKey identifies a frame by its caller frame and its call site. As the caller frames are interned, the key
+// identifies the whole call stack.
+type callFrameKey struct {
+	caller *CallStack
+	site   ssa.CallInstruction
+}
+
+// callFrames interns the frames of the call stacks.
+type callFrames map[callFrameKey]*CallStack
+
+// push returns the frame of the call site on top of the call stack cs, which is created on first use.
+func (frames callFrames) push(fset *token.FileSet, cs *CallStack, site ssa.CallInstruction) *CallStack {
+	k := callFrameKey{caller: cs, site: site}
+	if f, ok := frames[k]; ok {
+		return f
+	}
+	f := &CallStack{
+		Caller: cs,
+		Site:   site,
+		Pos:    InstrPosition(fset, site),
+		n:      cs.depth() + 1,
+	}
+	frames[k] = f
+	return f
+}
+
+// depth returns the number of the frames of the call stack.
+func (cs *CallStack) depth() int {
+	if cs == nil {
+		return 0
+	}
+	return cs.n
+}
+
+// calls checks whether any of the call sites in the call stack is inside the function fn, i.e. calling fn again is
+// a recursive call.
+func (cs *CallStack) calls(fn *ssa.Function) bool {
+	for f := cs; f != nil; f = f.Caller {
+		if f.Site.Parent() == fn {
+			return true
+		}
+	}
+	return false
+}
+
+// Frames returns the frames of the call stack, from the outermost call site to the innermost one.
+func (cs *CallStack) Frames() []*CallStack {
+	var frames []*CallStack
+	for f := cs; f != nil; f = f.Caller {
+		frames = append(frames, f)
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+func (cs *CallStack) String() string {
+	var positions []string
+	for _, f := range cs.Frames() {
+		positions = append(positions, f.Pos.String())
+	}
+	return strings.Join(positions, " -> ")
+}
@@ -0,0 +1,288 @@
+package usedtype
+
+import (
+	"fmt"
+	"go/constant"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// ImplicitUsageFunc is a function that accesses the fields of one of its arguments implicitly, e.g. a decoder that
+// fills the fields via reflection.
+type ImplicitUsageFunc struct {
+	// Pkg is the import path of the package that defines the function.
+	Pkg string
+	// Name is the name of the function, or "Type.Method" for a method (e.g. "Decoder.Decode").
+	Name string
+	// Arg is the index of the argument whose fields are accessed. The receiver of a method is not counted.
+	Arg int
+	// Tag is the key of the struct tag that decides the visible fields (e.g. "json"), a field is invisible if its tag
+	// is "-". If it is empty, all the exported fields are visible.
+	Tag string
+}
+
+func (f ImplicitUsageFunc) String() string {
+	return fmt.Sprintf("%s:%s:%d:%s", f.Pkg, f.Name, f.Arg, f.Tag)
+}
+
+// ParseImplicitUsageFunc parses an ImplicitUsageFunc in form of "<pkg path>:<name>:<arg index>[:<tag>]", e.g.
+// "github.com/mitchellh/mapstructure:Decode:1:mapstructure".
+func ParseImplicitUsageFunc(s string) (ImplicitUsageFunc, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return ImplicitUsageFunc{}, fmt.Errorf("invalid implicit usage function %q, expect <pkg path>:<name>:<arg index>[:<tag>]", s)
+	}
+	arg, err := strconv.Atoi(parts[2])
+	if err != nil || arg < 0 {
+		return ImplicitUsageFunc{}, fmt.Errorf("invalid argument index of implicit usage function %q", s)
+	}
+	f := ImplicitUsageFunc{
+		Pkg:  parts[0],
+		Name: parts[1],
+		Arg:  arg,
+	}
+	if len(parts) == 4 {
+		f.Tag = parts[3]
+	}
+	return f, nil
+}
+
+// DefaultImplicitUsageFuncs are the encoding/json, encoding/xml and gopkg.in/yaml functions that (un)marshal the
+// values of the structures.
+var DefaultImplicitUsageFuncs = []ImplicitUsageFunc{
+	{Pkg: "encoding/json", Name: "Marshal", Arg: 0, Tag: "json"},
+	{Pkg: "encoding/json", Name: "MarshalIndent", Arg: 0, Tag: "json"},
+	{Pkg: "encoding/json", Name: "Unmarshal", Arg: 1, Tag: "json"},
+	{Pkg: "encoding/json", Name: "Encoder.Encode", Arg: 0, Tag: "json"},
+	{Pkg: "encoding/json", Name: "Decoder.Decode", Arg: 0, Tag: "json"},
+	{Pkg: "encoding/xml", Name: "Marshal", Arg: 0, Tag: "xml"},
+	{Pkg: "encoding/xml", Name: "MarshalIndent", Arg: 0, Tag: "xml"},
+	{Pkg: "encoding/xml", Name: "Unmarshal", Arg: 1, Tag: "xml"},
+	{Pkg: "encoding/xml", Name: "Encoder.Encode", Arg: 0, Tag: "xml"},
+	{Pkg: "encoding/xml", Name: "Decoder.Decode", Arg: 0, Tag: "xml"},
+	{Pkg: "gopkg.in/yaml.v2", Name: "Marshal", Arg: 0, Tag: "yaml"},
+	{Pkg: "gopkg.in/yaml.v2", Name: "Unmarshal", Arg: 1, Tag: "yaml"},
+	{Pkg: "gopkg.in/yaml.v2", Name: "Encoder.Encode", Arg: 0, Tag: "yaml"},
+	{Pkg: "gopkg.in/yaml.v2", Name: "Decoder.Decode", Arg: 0, Tag: "yaml"},
+	{Pkg: "gopkg.in/yaml.v3", Name: "Marshal", Arg: 0, Tag: "yaml"},
+	{Pkg: "gopkg.in/yaml.v3", Name: "Unmarshal", Arg: 1, Tag: "yaml"},
+	{Pkg: "gopkg.in/yaml.v3", Name: "Encoder.Encode", Arg: 0, Tag: "yaml"},
+	{Pkg: "gopkg.in/yaml.v3", Name: "Decoder.Decode", Arg: 0, Tag: "yaml"},
+}
+
+// ImplicitUsageModel specifies how to find the fields that are accessed implicitly, i.e. without a Field or FieldAddr
+// instruction.
+type ImplicitUsageModel struct {
+	// Funcs are the functions that access all the visible fields of an argument, recursively.
+	Funcs []ImplicitUsageFunc
+
+	// If true, the calls of reflect.Value.FieldByName and reflect.Type.FieldByName with a constant name, on a value
+	// or type that comes from reflect.ValueOf or reflect.TypeOf, are resolved to the exact field.
+	FieldByName bool
+}
+
+// DefaultImplicitUsageModel returns a model with the DefaultImplicitUsageFuncs, which also resolves the FieldByName
+// calls.
+func DefaultImplicitUsageModel() *ImplicitUsageModel {
+	return &ImplicitUsageModel{
+		Funcs:       append([]ImplicitUsageFunc(nil), DefaultImplicitUsageFuncs...),
+		FieldByName: true,
+	}
+}
+
+// lookup returns the function in the model that is called by the call instruction, together with the argument whose
+// fields are accessed.
+func (model *ImplicitUsageModel) lookup(call ssa.CallInstruction) (*ImplicitUsageFunc, ssa.Value) {
+	common := call.Common()
+	fn := common.StaticCallee()
+	if fn == nil || fn.Pkg == nil {
+		return nil, nil
+	}
+	name := fn.Name()
+	args := common.Args
+	if recv := fn.Signature.Recv(); recv != nil {
+		nt, ok := DereferenceR(recv.Type()).(*types.Named)
+		if !ok {
+			return nil, nil
+		}
+		name = nt.Obj().Name() + "." + name
+		args = args[1:]
+	}
+	for i, f := range model.Funcs {
+		if f.Pkg != fn.Pkg.Pkg.Path() || f.Name != name || f.Arg >= len(args) {
+			continue
+		}
+		return &model.Funcs[i], args[f.Arg]
+	}
+	return nil, nil
+}
+
+// recordImplicit records the fields that are accessed implicitly by the call instruction, according to the model.
+func (r *directUsageRecorder) recordImplicit(call ssa.CallInstruction, model *ImplicitUsageModel) {
+	if f, arg := model.lookup(call); f != nil {
+		seen := map[*types.Named]struct{}{}
+		arg = concreteValue(arg)
+		for _, elem := range ElemTypes(arg.Type(), false) {
+			if nt, ok := elem.Type.(*types.Named); ok && IsUnderlyingNamedStruct(nt) {
+				r.recordVisibleFields(call, arg, nt, f.Tag, seen)
+			}
+		}
+		return
+	}
+	if !model.FieldByName {
+		return
+	}
+	nt, name, value, ok := fieldByName(call)
+	if !ok {
+		return
+	}
+	obj, path, _ := types.LookupFieldOrMethod(nt, true, nt.Obj().Pkg(), name)
+	if _, ok := obj.(*types.Var); !ok {
+		return
+	}
+	// The path goes through the embedded fields, for a promoted field.
+	for _, index := range path {
+		r.recordField(call, value, nt, index, AccessKindImplicit)
+		next, ok := DereferenceR(nt.Underlying().(*types.Struct).Field(index).Type()).(*types.Named)
+		if !ok || !IsUnderlyingNamedStruct(next) {
+			break
+		}
+		nt = next
+	}
+}
+
+// recordVisibleFields records the fields of the Named structure nt that are visible by the tag key, and the visible
+// fields of the structures held by them, recursively. The arg is the argument of the call, through which the fields
+// are accessed.
+func (r *directUsageRecorder) recordVisibleFields(call ssa.CallInstruction, arg ssa.Value, nt *types.Named, tag string, seen map[*types.Named]struct{}) {
+	if _, ok := seen[nt]; ok {
+		return
+	}
+	seen[nt] = struct{}{}
+
+	st := nt.Underlying().(*types.Struct)
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		// Note that a field tagged as "-," is visible, whose name is "-".
+		if tag != "" && reflect.StructTag(st.Tag(i)).Get(tag) == "-" {
+			continue
+		}
+		// The fields of an unexported embedded structure are still visible, as the promoted fields.
+		if !field.Exported() && !field.Embedded() {
+			continue
+		}
+		r.recordField(call, arg, nt, i, AccessKindImplicit)
+		for _, elem := range ElemTypes(field.Type(), false) {
+			if nested, ok := elem.Type.(*types.Named); ok && IsUnderlyingNamedStruct(nested) {
+				r.recordVisibleFields(call, arg, nested, tag, seen)
+			}
+		}
+	}
+}
+
+// concreteValue returns the value before it is converted to an interface.
+func concreteValue(v ssa.Value) ssa.Value {
+	for {
+		switch x := v.(type) {
+		case *ssa.MakeInterface:
+			return x.X
+		case *ssa.ChangeInterface:
+			v = x.X
+		default:
+			return v
+		}
+	}
+}
+
+// fieldByName checks whether the call is a reflect.Value.FieldByName or reflect.Type.FieldByName with a constant
+// name, and returns the Named structure it is called on, together with the field name and the value that is passed
+// to reflect.ValueOf or reflect.TypeOf.
+func fieldByName(call ssa.CallInstruction) (*types.Named, string, ssa.Value, bool) {
+	common := call.Common()
+	var (
+		recv ssa.Value
+		args []ssa.Value
+	)
+	if common.IsInvoke() {
+		if !isReflectObject(common.Method, "FieldByName") || !isReflectType(common.Value.Type(), "Type") {
+			return nil, "", nil, false
+		}
+		recv, args = common.Value, common.Args
+	} else {
+		fn := common.StaticCallee()
+		if fn == nil || !isReflectObject(fn.Object(), "FieldByName") || fn.Signature.Recv() == nil || !isReflectType(fn.Signature.Recv().Type(), "Value") {
+			return nil, "", nil, false
+		}
+		recv, args = common.Args[0], common.Args[1:]
+	}
+	if len(args) != 1 {
+		return nil, "", nil, false
+	}
+	c, ok := args[0].(*ssa.Const)
+	if !ok || c.Value == nil || c.Value.Kind() != constant.String {
+		return nil, "", nil, false
+	}
+	t, value := reflected(recv)
+	nt, ok := t.(*types.Named)
+	if !ok || !IsUnderlyingNamedStruct(nt) {
+		return nil, "", nil, false
+	}
+	return nt, constant.StringVal(c.Value), value, true
+}
+
+// reflected returns the type that the reflect.Value or reflect.Type v stands for, if v comes from reflect.ValueOf or
+// reflect.TypeOf, followed by any number of Elem (or reflect.Indirect) calls, together with the value passed to
+// reflect.ValueOf or reflect.TypeOf. Otherwise, it returns nils.
+func reflected(v ssa.Value) (types.Type, ssa.Value) {
+	call, ok := v.(*ssa.Call)
+	if !ok {
+		return nil, nil
+	}
+	common := call.Common()
+	if common.IsInvoke() {
+		if !isReflectObject(common.Method, "Elem") {
+			return nil, nil
+		}
+		t, value := reflected(common.Value)
+		return elemOf(t), value
+	}
+	fn := common.StaticCallee()
+	if fn == nil || len(common.Args) == 0 {
+		return nil, nil
+	}
+	switch {
+	case isReflectObject(fn.Object(), "ValueOf"), isReflectObject(fn.Object(), "TypeOf"):
+		value := concreteValue(common.Args[0])
+		return value.Type(), value
+	case isReflectObject(fn.Object(), "Elem"), isReflectObject(fn.Object(), "Indirect"):
+		t, value := reflected(common.Args[0])
+		return elemOf(t), value
+	}
+	return nil, nil
+}
+
+// elemOf returns the element type of a pointer type t, and nil otherwise.
+func elemOf(t types.Type) types.Type {
+	if t == nil {
+		return nil
+	}
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		return p.Elem()
+	}
+	return nil
+}
+
+// isReflectObject checks whether obj is the function or method of the given name, defined in the reflect package.
+func isReflectObject(obj types.Object, name string) bool {
+	return obj != nil && obj.Pkg() != nil && obj.Pkg().Path() == "reflect" && obj.Name() == name
+}
+
+// isReflectType checks whether t is the named type of the given name, defined in the reflect package.
+func isReflectType(t types.Type, name string) bool {
+	nt, ok := DereferenceR(t).(*types.Named)
+	return ok && isReflectObject(nt.Obj(), name)
+}
@@ -1,6 +1,7 @@
 package usedtype
 
 import (
+	"context"
 	"go/token"
 	"go/types"
 	"regexp"
@@ -12,9 +13,15 @@ import (
 
 type NamedTypeAllocSet map[*types.Named]AllocSet
 
+// Alloc is a root value of a target named type, see RootKind for the kinds of roots.
 type Alloc struct {
+	// Instr is the instruction that defines the root value. For a parameter root, it is the first instruction of the
+	// enclosing function. For a global root, it is nil, which means the root is regarded as reachable from everywhere.
 	Instr    ssa.Instruction
 	Position token.Position
+
+	Kind  RootKind
+	Value ssa.Value
 }
 
 type Allocs []Alloc
@@ -34,40 +41,81 @@ type AllocSet map[Alloc]struct{}
 
 type NamedTypeFilter func(pkg *packages.Package, t *types.Named) bool
 
-// FindPackageNamedTypeAllocSet finds all the Alloc instructions among the SSA packages, whose underlying type is
-// a named type that is defined in a package whose import path matches the "p" (pattern).
+// NamedTypeAllocSetOption specifies how to find the roots of the target named types.
+type NamedTypeAllocSetOption struct {
+	// RootKinds are the kinds of the roots to find. If it is zero, RootKindDefault is used.
+	RootKinds RootKind
+
+	// Generic specifies how the roots of the instantiated generic types are reported, which should be the same as the
+	// one used to find the direct usages (see StructDirectUsageOption.Generic).
+	Generic GenericMode
+
+	// GenericContext dedupes the identical instantiations of the generic types, which should be the same as the one
+	// used to find the direct usages (see NewGenericContext).
+	GenericContext *types.Context
+}
+
+func (opt *NamedTypeAllocSetOption) genericMode() GenericMode {
+	if opt == nil {
+		return GenericModeNA
+	}
+	return opt.Generic
+}
+
+func (opt *NamedTypeAllocSetOption) genericContext() *types.Context {
+	if opt == nil {
+		return nil
+	}
+	return opt.GenericContext
+}
+
+func (opt *NamedTypeAllocSetOption) rootKinds() RootKind {
+	if opt == nil || opt.RootKinds == 0 {
+		return RootKindDefault
+	}
+	return opt.RootKinds
+}
+
+// FindPackageNamedTypeAllocSet finds all the roots (by default, the Alloc and MakeInterface instructions) among the
+// SSA packages, whose underlying type is a named type that is defined in a package whose import path matches the
+// "p" (pattern).
 // If filter is given, it will further narrow down the result.
 // TODO: we should eliminate the case that the alloc takes the value from a function variable.
 func FindNamedTypeAllocSetInPackage(pkgs []*packages.Package, ssapkgs []*ssa.Package, p *regexp.Regexp, filter NamedTypeFilter) NamedTypeAllocSet {
+	return FindNamedTypeAllocSetInPackageWithOptions(pkgs, ssapkgs, p, filter, nil)
+}
+
+// FindNamedTypeAllocSetInPackageWithOptions is like FindNamedTypeAllocSetInPackage, but the kinds of roots can be
+// chosen by the opt, which can be nil.
+func FindNamedTypeAllocSetInPackageWithOptions(pkgs []*packages.Package, ssapkgs []*ssa.Package, p *regexp.Regexp, filter NamedTypeFilter, opt *NamedTypeAllocSetOption) NamedTypeAllocSet {
+	s, _ := FindNamedTypeAllocSetInPackageContext(context.Background(), pkgs, ssapkgs, p, filter, opt)
+	return s
+}
+
+// FindNamedTypeAllocSetInPackageContext is like FindNamedTypeAllocSetInPackageWithOptions, but stops once the context is done,
+// and returns a *StageError together with the roots found in the packages that have been walked through.
+func FindNamedTypeAllocSetInPackageContext(ctx context.Context, pkgs []*packages.Package, ssapkgs []*ssa.Package, p *regexp.Regexp, filter NamedTypeFilter, opt *NamedTypeAllocSetOption) (NamedTypeAllocSet, error) {
+	kinds := opt.rootKinds()
 	s := NamedTypeAllocSet{}
 	for idx := range ssapkgs {
+		if err := checkStage(ctx, StageFindRoots); err != nil {
+			return s, err
+		}
 		ssapkg := ssapkgs[idx]
 		pkg := pkgs[idx]
 
-		var cb WalkInstrCallback
-		cb = func(instr ssa.Instruction) {
-			var nt *types.Named
-			var ok bool
-
-			switch instr := instr.(type) {
-			case *ssa.Alloc:
-				t := DereferenceRElem(instr.Type())
-				nt, ok = t.(*types.Named)
-				if !ok {
-					return
-				}
-			case *ssa.MakeInterface:
-				nt, ok = instr.Type().(*types.Named)
-				if !ok {
-					return
-				}
-			default:
+		add := func(t types.Type, alloc Alloc) {
+			if alloc.Kind&kinds == 0 {
+				return
+			}
+			nt, ok := t.(*types.Named)
+			if !ok {
 				return
 			}
-
 			if nt.Obj() == nil {
 				return
 			}
+			nt = canonicalNamed(nt, opt.genericMode(), opt.genericContext())
 			if nt.Obj().Pkg() == nil {
 				return
 			}
@@ -83,13 +131,50 @@ func FindNamedTypeAllocSetInPackage(pkgs []*packages.Package, ssapkgs []*ssa.Pac
 				aset = AllocSet{}
 				s[nt] = aset
 			}
-			aset[Alloc{
+			aset[alloc] = struct{}{}
+		}
+
+		icb := func(instr ssa.Instruction) {
+			t, kind := instrRoot(instr)
+			if t == nil {
+				return
+			}
+			// The initializer of a global root is regarded as part of the global root, rather than a separate one.
+			if kinds&RootKindGlobal != 0 && initializedGlobal(instr, t) != nil {
+				return
+			}
+			v, _ := instr.(ssa.Value)
+			add(t, Alloc{
 				Instr:    instr,
 				Position: InstrPosition(pkg.Fset, instr),
-			}] = struct{}{}
+				Kind:     kind,
+				Value:    v,
+			})
+		}
+		vcb := func(v ssa.Value) {
+			t, kind := valueRoot(v)
+			if t == nil {
+				return
+			}
+			alloc := Alloc{
+				Position: pkg.Fset.Position(v.Pos()),
+				Kind:     kind,
+				Value:    v,
+			}
+			if param, ok := v.(*ssa.Parameter); ok {
+				fn := param.Parent()
+				if len(fn.Blocks) == 0 || len(fn.Blocks[0].Instrs) == 0 {
+					return
+				}
+				alloc.Instr = fn.Blocks[0].Instrs[0]
+				if !alloc.Position.IsValid() {
+					alloc.Position = InstrPosition(pkg.Fset, alloc.Instr)
+				}
+			}
+			add(t, alloc)
 		}
 		ssaTraversal := NewTraversal()
-		ssaTraversal.WalkInPackage(ssapkg, cb, nil)
+		ssaTraversal.WalkInPackage(ssapkg, icb, vcb)
 	}
-	return s
+	return s, nil
 }
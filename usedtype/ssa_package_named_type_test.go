@@ -0,0 +1,56 @@
+package usedtype_test
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/magodo/usedtype/usedtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindNamedTypeAllocSetInPackageRootKinds(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathRootKind, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+
+	cases := []struct {
+		opt    *usedtype.NamedTypeAllocSetOption
+		expect []string
+	}{
+		{
+			nil,
+			[]string{"sdk.Animal make-interface 26:32", "sdk.Property alloc 21:2"},
+		},
+		{
+			&usedtype.NamedTypeAllocSetOption{RootKinds: usedtype.RootKindDefault | usedtype.RootKindGlobal},
+			[]string{"sdk.Animal make-interface 26:32", "sdk.Property alloc 21:2", "sdk.Property global 7:5"},
+		},
+		{
+			&usedtype.NamedTypeAllocSetOption{RootKinds: usedtype.RootKindAll},
+			[]string{
+				"sdk.Animal make-interface 26:32",
+				"sdk.Dog call-result 26:32",
+				"sdk.Dog type-assert 27:16",
+				"sdk.ModelA call-result 18:16",
+				"sdk.ModelA parameter 35:11",
+				"sdk.Property alloc 21:2",
+				"sdk.Property call-result 21:17",
+				"sdk.Property deref 14:9",
+				"sdk.Property global 7:5",
+			},
+		},
+	}
+
+	for idx, c := range cases {
+		rootSet := usedtype.FindNamedTypeAllocSetInPackageWithOptions(pkgs, ssapkgs, regexp.MustCompile("sdk"), nil, c.opt)
+		actual := []string{}
+		for nt, allocSet := range rootSet {
+			for alloc := range allocSet {
+				actual = append(actual, fmt.Sprintf("%s %s %d:%d", nt, alloc.Kind, alloc.Position.Line, alloc.Position.Column))
+			}
+		}
+		sort.Strings(actual)
+		require.Equal(t, c.expect, actual, idx)
+	}
+}
@@ -0,0 +1,266 @@
+package usedtype
+
+import (
+	"context"
+	"go/token"
+	"go/types"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/pointer"
+	"golang.org/x/tools/go/ssa"
+)
+
+// PointsTo records the points-to sets (by pointer analysis) of the roots and the structures accessed by the virtual
+// access points, which is used to tell whether a field access happens on the same instance as a root.
+type PointsTo struct {
+	// sites maps the queried pointer to the allocation sites of the objects that it may point to.
+	sites map[ssa.Value]allocSites
+	// contents maps the field address to the allocation sites of the objects that the stored pointer (if the field
+	// is pointer-like) may point to.
+	contents map[ssa.Value]allocSites
+	// globals maps the global roots to the allocation sites of the objects that they refer to, which include the
+	// global variables themselves, the objects that they point to (if pointer-like), and the objects stored into them
+	// by the init functions.
+	globals map[*ssa.Global]allocSites
+
+	// CallGraph is the call graph built by the pointer analysis, which is the same as the one of CallGraphTypePta
+	// (i.e. the one of CallGraphTypeCha if the pointer analysis fails).
+	CallGraph *callgraph.Graph
+
+	// UnresolvedRoots are the roots that have no points-to information (e.g. a structure returned by value).
+	UnresolvedRoots Allocs
+	// UnresolvedAccessPoints are the virtual access points whose accessed structure has no points-to information.
+	UnresolvedAccessPoints []VirtAccessPoint
+}
+
+// allocSites is a set of allocation sites, which are the values that create the objects in the pointer analysis.
+type allocSites map[ssa.Value]struct{}
+
+func newAllocSites(pts pointer.PointsToSet) allocSites {
+	out := allocSites{}
+	for _, l := range pts.Labels() {
+		if v := l.Value(); v != nil {
+			out[v] = struct{}{}
+		}
+	}
+	return out
+}
+
+func (s allocSites) add(other allocSites) {
+	for v := range other {
+		s[v] = struct{}{}
+	}
+}
+
+func (s allocSites) intersects(other allocSites) bool {
+	for v := range s {
+		if _, ok := other[v]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pointerOf returns the pointer value whose points-to set represents the instance referred by the value v, or nil if
+// there is none. E.g. for a structure loaded from a pointer, it returns the pointer.
+func pointerOf(v ssa.Value) ssa.Value {
+	if v == nil {
+		return nil
+	}
+	if _, ok := v.Type().Underlying().(*types.Interface); ok {
+		if mi, ok := v.(*ssa.MakeInterface); ok {
+			return pointerOf(mi.X)
+		}
+		return nil
+	}
+	if pointer.CanPoint(v.Type()) {
+		return v
+	}
+	if load, ok := v.(*ssa.UnOp); ok && load.Op == token.MUL {
+		return pointerOf(load.X)
+	}
+	return nil
+}
+
+// pointerAnalyze runs the pointer analysis, which is replaced in the tests.
+var pointerAnalyze = pointer.Analyze
+
+// AnalyzePointsTo runs the pointer analysis on the program, which requires a whole program (i.e. the main packages),
+// and records the points-to sets of the roots in rootSet and the structures accessed in dm. The roots and accesses
+// whose points-to sets can't be queried are recorded as unresolved. If the pointer analysis fails (e.g. on the type
+// aliases, which it doesn't support), all of them are recorded as unresolved, i.e. they are linked by type.
+func AnalyzePointsTo(prog *ssa.Program, rootSet NamedTypeAllocSet, dm StructDirectUsageMap) (*PointsTo, error) {
+	return AnalyzePointsToContext(context.Background(), prog, rootSet, dm)
+}
+
+// AnalyzePointsToContext is like AnalyzePointsTo, but returns a *StageError once the context is done. Note that the
+// pointer analysis can't be cancelled, it is left running to completion in the background.
+func AnalyzePointsToContext(ctx context.Context, prog *ssa.Program, rootSet NamedTypeAllocSet, dm StructDirectUsageMap) (*PointsTo, error) {
+	mains, err := mainPackages(prog.AllPackages())
+	if err != nil {
+		return nil, err
+	}
+	config := &pointer.Config{
+		Mains:          mains,
+		BuildCallGraph: true,
+	}
+
+	out := &PointsTo{
+		sites:    map[ssa.Value]allocSites{},
+		contents: map[ssa.Value]allocSites{},
+		globals:  map[*ssa.Global]allocSites{},
+	}
+
+	queried := map[ssa.Value]struct{}{}
+	indirectQueried := map[ssa.Value]struct{}{}
+	query := func(v ssa.Value) bool {
+		p := pointerOf(v)
+		if p == nil {
+			return false
+		}
+		if _, ok := queried[p]; !ok {
+			queried[p] = struct{}{}
+			config.AddQuery(p)
+		}
+		return true
+	}
+
+	indirectQuery := func(v ssa.Value) {
+		if _, ok := indirectQueried[v]; !ok {
+			indirectQueried[v] = struct{}{}
+			config.AddIndirectQuery(v)
+		}
+	}
+
+	globalInits := map[*ssa.Global][]ssa.Value{}
+	for _, allocSet := range rootSet {
+		for alloc := range allocSet {
+			if g, ok := alloc.Value.(*ssa.Global); ok {
+				query(g)
+				if pointer.CanPoint(g.Type().Underlying().(*types.Pointer).Elem()) {
+					indirectQuery(g)
+				}
+				globalInits[g] = globalInitializers(g)
+				for _, v := range globalInits[g] {
+					query(v)
+				}
+				continue
+			}
+			if !query(alloc.Value) {
+				out.UnresolvedRoots = append(out.UnresolvedRoots, alloc)
+			}
+		}
+	}
+	for _, du := range dm {
+		for _, vaps := range du {
+			for _, vap := range vaps {
+				if !query(accessedValue(vap)) {
+					out.UnresolvedAccessPoints = append(out.UnresolvedAccessPoints, vap)
+				}
+				// Query the objects that the field points to, which are the nested instances of the accessed one.
+				if fa, ok := vap.Instr.(*ssa.FieldAddr); ok && pointer.CanPoint(fa.Type().Underlying().(*types.Pointer).Elem()) {
+					indirectQuery(fa)
+				}
+			}
+		}
+	}
+
+	var (
+		res        *pointer.Result
+		analyzeErr error
+	)
+	if err := runStage(ctx, StageAnalyzePointsTo, func() { res, analyzeErr = pointerAnalyze(config) }); err != nil {
+		return nil, err
+	}
+	if analyzeErr != nil {
+		log.Warnf("Pointer analysis failed, the roots and the field accesses are linked by type: %v", analyzeErr)
+		out.UnresolvedRoots, out.UnresolvedAccessPoints = nil, nil
+		for _, allocSet := range rootSet {
+			for alloc := range allocSet {
+				out.UnresolvedRoots = append(out.UnresolvedRoots, alloc)
+			}
+		}
+		sort.Sort(out.UnresolvedRoots)
+		for _, du := range dm {
+			for _, vaps := range du {
+				out.UnresolvedAccessPoints = append(out.UnresolvedAccessPoints, vaps...)
+			}
+		}
+		out.CallGraph = cha.CallGraph(prog)
+		return out, nil
+	}
+	for v, p := range res.Queries {
+		out.sites[v] = newAllocSites(p.PointsTo())
+	}
+	for v, p := range res.IndirectQueries {
+		out.contents[v] = newAllocSites(p.PointsTo())
+	}
+	for g, inits := range globalInits {
+		sites := allocSites{}
+		for _, v := range append([]ssa.Value{g}, inits...) {
+			if vsites, ok := out.allocSitesOf(v); ok {
+				sites.add(vsites)
+			}
+		}
+		sites.add(out.contents[g])
+		out.globals[g] = sites
+	}
+	out.CallGraph = res.CallGraph
+	return out, nil
+}
+
+// MergePointsTo merges the points-to information, e.g. the ones analyzed from the programs of different build
+// configurations (see LoadOptions). The nil ones are skipped. The call graphs are not merged, see MergeBuildResults
+// for that.
+func MergePointsTo(ptss ...*PointsTo) *PointsTo {
+	var out *PointsTo
+	for _, pts := range ptss {
+		if pts == nil {
+			continue
+		}
+		if out == nil {
+			out = &PointsTo{
+				sites:    map[ssa.Value]allocSites{},
+				contents: map[ssa.Value]allocSites{},
+				globals:  map[*ssa.Global]allocSites{},
+			}
+		}
+		for v, sites := range pts.sites {
+			out.sites[v] = sites
+		}
+		for v, sites := range pts.contents {
+			out.contents[v] = sites
+		}
+		for g, sites := range pts.globals {
+			out.globals[g] = sites
+		}
+		out.UnresolvedRoots = append(out.UnresolvedRoots, pts.UnresolvedRoots...)
+		out.UnresolvedAccessPoints = append(out.UnresolvedAccessPoints, pts.UnresolvedAccessPoints...)
+	}
+	return out
+}
+
+// allocSitesOf returns the allocation sites of the objects that the value v may refer to. The second return value
+// indicates whether v has the points-to information.
+func (pts *PointsTo) allocSitesOf(v ssa.Value) (allocSites, bool) {
+	p := pointerOf(v)
+	if p == nil {
+		return nil, false
+	}
+	sites, ok := pts.sites[p]
+	return sites, ok
+}
+
+// rootSitesOf returns the allocation sites of the objects that the root refers to. The second return value indicates
+// whether the root has the points-to information.
+func (pts *PointsTo) rootSitesOf(alloc Alloc) (allocSites, bool) {
+	if g, ok := alloc.Value.(*ssa.Global); ok {
+		sites, ok := pts.globals[g]
+		return sites, ok
+	}
+	return pts.allocSitesOf(alloc.Value)
+}
@@ -0,0 +1,148 @@
+package usedtype_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"golang.org/x/tools/go/pointer"
+
+	"github.com/magodo/usedtype/usedtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildStructFullUsagesPointsTo(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathValueFlow, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+	pts, err := usedtype.AnalyzePointsTo(ssapkgs[0].Prog, targetRootSet, directUsage)
+	require.NoError(t, err)
+	require.Empty(t, pts.UnresolvedRoots)
+	require.Empty(t, pts.UnresolvedAccessPoints)
+
+	fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet,
+		&usedtype.StructFullBuildOption{
+			Callgraph: pts.CallGraph,
+			PointsTo:  pts,
+		},
+	)
+
+	// Each instance only has the fields that are used on itself, the structure copies are different instances.
+	require.Equal(t, []string{
+		`13: sdk.ModelA
+    PointerOfProperty (pointer_of_property)
+        Int (int)`,
+		`18: sdk.ModelA
+    ArrayOfString (array_of_string)`,
+		`31: sdk.ModelA
+    String (string)`,
+		`8: sdk.ModelA
+    String (string)
+    Property (property)`,
+	}, usagesPerAlloc(t, fus))
+}
+
+func TestAnalyzePointsToUnresolved(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathRootKind, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackageWithOptions(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.Property"),
+		&usedtype.NamedTypeAllocSetOption{RootKinds: usedtype.RootKindCallResult})
+	pts, err := usedtype.AnalyzePointsTo(ssapkgs[0].Prog, targetRootSet, directUsage)
+	require.NoError(t, err)
+
+	// The structure returned by value has no points-to information
+	require.Len(t, pts.UnresolvedRoots, 1)
+	require.Equal(t, 21, pts.UnresolvedRoots[0].Position.Line)
+}
+
+func TestBuildStructFullUsagesGlobalRoot(t *testing.T) {
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathGlobalRoot, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackageWithOptions(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"),
+		&usedtype.NamedTypeAllocSetOption{RootKinds: usedtype.RootKindDefault | usedtype.RootKindGlobal})
+	pts, err := usedtype.AnalyzePointsTo(ssapkgs[0].Prog, targetRootSet, directUsage)
+	require.NoError(t, err)
+
+	// The composite literals that initialize the globals are part of the global roots, which are positioned at the
+	// declarations and linked to the usages in both the init functions and the later loads.
+	expect := []string{
+		`18: sdk.ModelA
+    ArrOfPropWrapper (array_of_prop_wrapper)`,
+		`7: sdk.ModelA
+    String (string)
+    Property (property)
+    PointerOfProperty (pointer_of_property)`,
+		`9: sdk.ModelA
+    ArrayOfString (array_of_string)
+    PropWrapper (prop_wrapper)`,
+	}
+	for idx, opt := range []*usedtype.StructFullBuildOption{
+		{Callgraph: graph, ValueFlow: usedtype.NewValueFlowGraph(ssapkgs[0].Prog, graph)},
+		{Callgraph: graph, PointsTo: pts},
+		// The merged points-to information (e.g. of multiple build configurations) keeps the global roots.
+		{Callgraph: graph, PointsTo: usedtype.MergePointsTo(nil, pts)},
+	} {
+		fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, opt)
+		require.Equal(t, expect, usagesPerAlloc(t, fus), idx)
+	}
+}
+
+func TestAnalyzePointsToContextCanceledDuringAnalysis(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathValueFlow, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+
+	// The pointer analysis doesn't finish until the test returns.
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	defer usedtype.SetPointerAnalyze(func(config *pointer.Config) (*pointer.Result, error) {
+		close(started)
+		<-release
+		return pointer.Analyze(config)
+	})()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err = usedtype.AnalyzePointsToContext(ctx, ssapkgs[0].Prog, targetRootSet, directUsage)
+	var stageErr *usedtype.StageError
+	require.True(t, errors.As(err, &stageErr))
+	require.Equal(t, usedtype.StageAnalyzePointsTo, stageErr.Stage)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.True(t, time.Since(start) < 10*time.Second)
+}
+
+func TestAnalyzePointsToFallback(t *testing.T) {
+	// The pointer analysis fails on the type aliases used by the standard library (e.g. fmt).
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathPointerFallback, []string{"."}, usedtype.CallGraphTypePta)
+	require.NoError(t, err)
+	require.NotNil(t, graph)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+	pts, err := usedtype.AnalyzePointsTo(ssapkgs[0].Prog, targetRootSet, directUsage)
+	require.NoError(t, err)
+	require.NotNil(t, pts.CallGraph)
+	require.Len(t, pts.UnresolvedRoots, 2)
+	require.Len(t, pts.UnresolvedAccessPoints, 2)
+
+	// The roots and the field accesses are linked by type.
+	fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, &usedtype.StructFullBuildOption{Callgraph: graph, PointsTo: pts})
+	require.Equal(t, []string{
+		`10: sdk.ModelA
+    String (string)
+    ArrayOfString (array_of_string)`,
+		`13: sdk.ModelA
+    String (string)
+    ArrayOfString (array_of_string)`,
+	}, usagesPerAlloc(t, fus))
+}
@@ -0,0 +1,299 @@
+package usedtype
+
+import (
+	"sync"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// checkInstructionReachability checks whether two instructions can reach the other in either direction.
+// Ideally, for a read field access, we should ensure the root structure can reach the child field's read;
+// Otherwise, for a write field access, we should ensure the write of the child field happens first.
+// Though the access kind of each virtual access point is known (see InstrAccessKind), an address escaped access
+// can still be either a read or a write.
+// Practically, we ignore this difference here, but simply check whether two instructions can reach the other in either direction.
+func checkInstructionReachability(i1, i2 ssa.Instruction, reach *reachabilityIndex) bool {
+	// A nil instruction (e.g. of a global root) is regarded as reachable from everywhere.
+	if i1 == nil || i2 == nil {
+		return true
+	}
+	return mayPrecede(i1, i2, reach) || mayPrecede(i2, i1, reach)
+}
+
+// mayPrecede checks whether there is an execution path that executes i1 before i2. In dominance mode (see
+// StructFullBuildOption.Dominance), it checks whether i1 is executed before i2 on every path to i2 instead.
+// In case i1 and i2 are in different functions, it requires one of the functions calls (transitively) the other, and:
+// - If i1's function calls i2's function, i1 can reach at least one of the call sites that lead to i2's function.
+// - If i2's function calls i1's function, at least one of the call sites that lead to i1's function can reach i2.
+func mayPrecede(i1, i2 ssa.Instruction, reach *reachabilityIndex) bool {
+	f1, f2 := i1.Parent(), i2.Parent()
+	if f1 == f2 {
+		return reach.instrPrecedes(i1, i2)
+	}
+
+	// For some whole program algorithms (e.g. rta), the callgraph only contains the subset of functions that reachable from main().
+	// If the instruction here isn't reachable from main, then we should regard them as not reachable.
+	n1, n2 := reach.graph.Nodes[f1], reach.graph.Nodes[f2]
+	if n1 == nil || n2 == nil {
+		return false
+	}
+	if !reach.canReach(n1, n2) && !reach.canReach(n2, n1) {
+		return false
+	}
+
+	for _, site := range reach.callSitesLeadingTo(n1, n2) {
+		if reach.instrPrecedes(i1, site) {
+			return true
+		}
+	}
+	for _, site := range reach.callSitesLeadingTo(n2, n1) {
+		if reach.instrPrecedes(site, i2) {
+			return true
+		}
+	}
+	return false
+}
+
+// callSitesLeadingTo returns the call sites in the function of node "from", whose callee is, or calls (transitively)
+// the function of node "to".
+func (idx *reachabilityIndex) callSitesLeadingTo(from, to *callgraph.Node) []ssa.Instruction {
+	var sites []ssa.Instruction
+	for _, e := range from.Out {
+		if e.Site == nil {
+			continue
+		}
+		if idx.canReach(e.Callee, to) {
+			sites = append(sites, e.Site)
+		}
+	}
+	return sites
+}
+
+// instrPrecedes checks whether the instruction i1 precedes the instruction i2 in the same function, either on some
+// path, or on every path to i2 in dominance mode.
+func (idx *reachabilityIndex) instrPrecedes(i1, i2 ssa.Instruction) bool {
+	if idx.dominance {
+		return instrDominates(i1, i2)
+	}
+	return instrCanReach(i1, i2)
+}
+
+// instrDominates checks whether the instruction i1 dominates the instruction i2 in the same function, i.e. every path
+// from the entry to i2 goes through i1.
+func instrDominates(i1, i2 ssa.Instruction) bool {
+	b1, b2 := i1.Block(), i2.Block()
+	if b1 != b2 {
+		return b1.Dominates(b2)
+	}
+	for _, instr := range b1.Instrs {
+		if instr == i1 {
+			return true
+		}
+		if instr == i2 {
+			return false
+		}
+	}
+	return false
+}
+
+// instrCanReach checks whether the instruction i1 can reach the instruction i2 in the same function.
+func instrCanReach(i1, i2 ssa.Instruction) bool {
+	b1, b2 := i1.Block(), i2.Block()
+	if b1 != b2 {
+		return BBCanReach(b1, b2)
+	}
+
+	// In the same block, i1 reaches i2 if it comes first, or the block is in a loop.
+	for _, instr := range b1.Instrs {
+		if instr == i1 {
+			return true
+		}
+		if instr == i2 {
+			break
+		}
+	}
+	for _, succ := range b1.Succs {
+		if BBCanReach(succ, b1) {
+			return true
+		}
+	}
+	return false
+}
+
+// reachabilityIndex answers whether a function (transitively) calls another one in the call graph. It condenses the
+// call graph into the strongly connected components (SCCs), and caches the SCCs reachable from the recently queried
+// SCCs. It is safe for concurrent use.
+type reachabilityIndex struct {
+	graph *callgraph.Graph
+
+	// dominance tells whether the instructions in the same function are ordered by dominance, see mayPrecede.
+	dominance bool
+
+	// scc maps each node to the index of its SCC.
+	scc map[*callgraph.Node]int
+	// succs are the successors of each SCC in the condensed graph.
+	succs [][]int
+
+	mu sync.RWMutex
+	// reach caches the SCCs reachable from each SCC, including itself. It holds at most cacheSize entries, where the
+	// earliest cached one (in the order of the cached queue) is evicted first.
+	reach     map[int]bitset
+	cached    []int
+	cacheSize int
+}
+
+// reachCacheSize is the maximum number of the SCCs whose reachable SCCs are cached, so that the cache takes at most
+// reachCacheSize * (the number of SCCs) bits, rather than growing quadratically.
+const reachCacheSize = 1024
+
+// newReachabilityIndex builds the reachability index of the call graph in opt. It returns nil if there is no call
+// graph.
+func newReachabilityIndex(opt *StructFullBuildOption) *reachabilityIndex {
+	if opt == nil || opt.Callgraph == nil {
+		return nil
+	}
+	idx := newReachabilityIndexOf(opt.Callgraph, reachCacheSize)
+	idx.dominance = opt.dominance()
+	return idx
+}
+
+// newReachabilityIndexOf builds the reachability index of the call graph, which caches the reachable SCCs of at most
+// cacheSize SCCs.
+func newReachabilityIndexOf(graph *callgraph.Graph, cacheSize int) *reachabilityIndex {
+	idx := &reachabilityIndex{
+		graph:     graph,
+		scc:       map[*callgraph.Node]int{},
+		reach:     map[int]bitset{},
+		cacheSize: cacheSize,
+	}
+	idx.condense()
+	return idx
+}
+
+// condense finds the SCCs by Tarjan's algorithm, and builds the condensed graph.
+func (idx *reachabilityIndex) condense() {
+	var (
+		index   = map[*callgraph.Node]int{}
+		lowlink = map[*callgraph.Node]int{}
+		onStack = map[*callgraph.Node]bool{}
+		stack   []*callgraph.Node
+		nscc    int
+	)
+	var strongConnect func(n *callgraph.Node)
+	strongConnect = func(n *callgraph.Node) {
+		index[n] = len(index)
+		lowlink[n] = index[n]
+		stack = append(stack, n)
+		onStack[n] = true
+		for _, e := range n.Out {
+			m := e.Callee
+			if _, ok := index[m]; !ok {
+				strongConnect(m)
+				if lowlink[m] < lowlink[n] {
+					lowlink[n] = lowlink[m]
+				}
+			} else if onStack[m] && index[m] < lowlink[n] {
+				lowlink[n] = index[m]
+			}
+		}
+		if lowlink[n] != index[n] {
+			return
+		}
+		for {
+			m := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[m] = false
+			idx.scc[m] = nscc
+			if m == n {
+				break
+			}
+		}
+		nscc++
+	}
+	for _, n := range idx.graph.Nodes {
+		if _, ok := index[n]; !ok {
+			strongConnect(n)
+		}
+	}
+
+	idx.succs = make([][]int, nscc)
+	for n, c := range idx.scc {
+		seen := map[int]bool{}
+		for _, e := range n.Out {
+			if sc := idx.scc[e.Callee]; sc != c && !seen[sc] {
+				seen[sc] = true
+				idx.succs[c] = append(idx.succs[c], sc)
+			}
+		}
+	}
+}
+
+// reachable returns the SCCs reachable from the SCC c, including itself.
+func (idx *reachabilityIndex) reachable(c int) bitset {
+	idx.mu.RLock()
+	r, ok := idx.reach[c]
+	idx.mu.RUnlock()
+	if ok {
+		return r
+	}
+
+	r = newBitset(len(idx.succs))
+	r.set(c)
+	wl := []int{c}
+	for len(wl) != 0 {
+		c := wl[len(wl)-1]
+		wl = wl[:len(wl)-1]
+		for _, sc := range idx.succs[c] {
+			if r.has(sc) {
+				continue
+			}
+			r.set(sc)
+			wl = append(wl, sc)
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	// It might have been cached by another goroutine in the meantime.
+	if cr, ok := idx.reach[c]; ok {
+		return cr
+	}
+	if len(idx.cached) >= idx.cacheSize {
+		delete(idx.reach, idx.cached[0])
+		idx.cached = idx.cached[1:]
+	}
+	idx.reach[c] = r
+	idx.cached = append(idx.cached, c)
+	return r
+}
+
+// canReach checks whether the node "from" is, or calls (transitively) the node "to".
+func (idx *reachabilityIndex) canReach(from, to *callgraph.Node) bool {
+	if from == to {
+		return true
+	}
+	fc, ok := idx.scc[from]
+	if !ok {
+		return false
+	}
+	tc, ok := idx.scc[to]
+	if !ok {
+		return false
+	}
+	return idx.reachable(fc).has(tc)
+}
+
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << uint(i%64)
+}
+
+func (b bitset) has(i int) bool {
+	return b[i/64]&(1<<uint(i%64)) != 0
+}
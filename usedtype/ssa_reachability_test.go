@@ -0,0 +1,53 @@
+package usedtype_test
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/ssa"
+
+	"github.com/magodo/usedtype/usedtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReachabilityIndex(t *testing.T) {
+	_, ssapkgs, graph, err := usedtype.BuildPackages(pathReachabilityIndex, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	require.Len(t, ssapkgs, 1)
+	fn := func(name string) *ssa.Function {
+		f := ssapkgs[0].Func(name)
+		require.NotNil(t, f, name)
+		return f
+	}
+	main, ping, pong, countdown, leaf := fn("main"), fn("ping"), fn("pong"), fn("countdown"), fn("leaf")
+
+	// Only allow two SCCs to be cached, so that the queries below evict each other.
+	idx := usedtype.NewReachabilityIndex(graph, 2)
+
+	// The mutually recursive functions are condensed into one SCC, while the self recursive one is on its own.
+	require.True(t, idx.SameSCC(ping, pong))
+	require.False(t, idx.SameSCC(pong, countdown))
+	require.False(t, idx.SameSCC(main, ping))
+
+	cases := []struct {
+		from, to *ssa.Function
+		expect   bool
+	}{
+		{ping, pong, true},
+		{pong, ping, true},
+		{ping, countdown, true},
+		{countdown, countdown, true},
+		{countdown, ping, false},
+		{main, countdown, true},
+		{main, leaf, true},
+		{leaf, main, false},
+		{leaf, countdown, false},
+	}
+	// Query twice, the second round is answered by the cache or the re-computation after eviction.
+	for i := 0; i < 2; i++ {
+		for _, c := range cases {
+			require.Equal(t, c.expect, idx.CanReach(c.from, c.to), "%s -> %s", c.from.Name(), c.to.Name())
+			require.LessOrEqual(t, idx.Cached(), 2)
+		}
+	}
+	require.Equal(t, 2, idx.Cached())
+}
@@ -0,0 +1,210 @@
+package usedtype
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// RootKind describes where a root value of the target named type comes from. It is a bit set, so that multiple kinds
+// of roots can be selected at once.
+type RootKind int
+
+const (
+	// RootKindAlloc is an allocation, e.g. a composite literal or a local variable (*ssa.Alloc).
+	RootKindAlloc RootKind = 1 << iota
+	// RootKindMakeInterface is a conversion to a named interface (*ssa.MakeInterface).
+	RootKindMakeInterface
+	// RootKindCallResult is the (possibly extracted) result of a function call (*ssa.Call, *ssa.Extract).
+	RootKindCallResult
+	// RootKindParameter is a function parameter (*ssa.Parameter).
+	RootKindParameter
+	// RootKindGlobal is a package level variable (*ssa.Global). The values stored into it by the init functions (e.g.
+	// the composite literal in its declaration) are regarded as part of it, rather than separate roots.
+	RootKindGlobal
+	// RootKindDeref is a pointer dereference (*ssa.UnOp).
+	RootKindDeref
+	// RootKindTypeAssert is the (possibly extracted) result of a type assertion (*ssa.TypeAssert, *ssa.Extract).
+	RootKindTypeAssert
+
+	RootKindDefault = RootKindAlloc | RootKindMakeInterface
+	RootKindAll     = RootKindAlloc | RootKindMakeInterface | RootKindCallResult | RootKindParameter | RootKindGlobal | RootKindDeref | RootKindTypeAssert
+)
+
+var rootKindNames = []struct {
+	kind RootKind
+	name string
+}{
+	{RootKindAlloc, "alloc"},
+	{RootKindMakeInterface, "make-interface"},
+	{RootKindCallResult, "call-result"},
+	{RootKindParameter, "parameter"},
+	{RootKindGlobal, "global"},
+	{RootKindDeref, "deref"},
+	{RootKindTypeAssert, "type-assert"},
+}
+
+func (k RootKind) String() string {
+	var names []string
+	for _, kn := range rootKindNames {
+		if k&kn.kind != 0 {
+			names = append(names, kn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "unknown"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseRootKind parses a comma separated list of root kind names (i.e. "alloc", "make-interface", "call-result",
+// "parameter", "global", "deref", "type-assert" and "all") into a RootKind.
+func ParseRootKind(s string) (RootKind, error) {
+	var kind RootKind
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			kind |= RootKindAll
+			continue
+		}
+		found := false
+		for _, kn := range rootKindNames {
+			if kn.name == name {
+				kind |= kn.kind
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid root kind: %s", name)
+		}
+	}
+	return kind, nil
+}
+
+// instrRoot returns the type and the root kind of the value defined by the instruction, if it can be a root.
+// Otherwise, it returns a nil type.
+func instrRoot(instr ssa.Instruction) (types.Type, RootKind) {
+	switch instr := instr.(type) {
+	case *ssa.Alloc:
+		return DereferenceRElem(instr.Type()), RootKindAlloc
+	case *ssa.MakeInterface:
+		return instr.Type(), RootKindMakeInterface
+	case *ssa.Call:
+		return DereferenceRElem(instr.Type()), RootKindCallResult
+	case *ssa.UnOp:
+		if instr.Op != token.MUL {
+			return nil, 0
+		}
+		return DereferenceRElem(instr.Type()), RootKindDeref
+	case *ssa.TypeAssert:
+		if instr.CommaOk {
+			return nil, 0
+		}
+		return DereferenceRElem(instr.Type()), RootKindTypeAssert
+	case *ssa.Extract:
+		t := DereferenceRElem(instr.Type())
+		switch instr.Tuple.(type) {
+		case *ssa.Call:
+			return t, RootKindCallResult
+		case *ssa.TypeAssert:
+			return t, RootKindTypeAssert
+		}
+	}
+	return nil, 0
+}
+
+// valueRoot returns the type and the root kind of the value that is not defined by an instruction, if it can be a
+// root. Otherwise, it returns a nil type.
+func valueRoot(v ssa.Value) (types.Type, RootKind) {
+	switch v := v.(type) {
+	case *ssa.Parameter:
+		return DereferenceRElem(v.Type()), RootKindParameter
+	case *ssa.Global:
+		return DereferenceRElem(v.Type()), RootKindGlobal
+	}
+	return nil, 0
+}
+
+// isInitFunction checks whether the function is the package initializer, or one of the init() functions.
+func isInitFunction(fn *ssa.Function) bool {
+	if fn == nil || fn.Parent() != nil || fn.Signature.Recv() != nil {
+		return false
+	}
+	return fn.Name() == "init" || strings.HasPrefix(fn.Name(), "init#")
+}
+
+// initializedGlobal returns the global that the root value (defined by instr) is stored into, if it happens in an init
+// function and the global is a root of the same type. E.g. the composite literal in "var g = sdk.Foo{...}". Otherwise,
+// it returns nil.
+func initializedGlobal(instr ssa.Instruction, t types.Type) *ssa.Global {
+	v, ok := instr.(ssa.Value)
+	if !ok || !isInitFunction(instr.Parent()) {
+		return nil
+	}
+	storedGlobal := func(v ssa.Value) *ssa.Global {
+		referrers := v.Referrers()
+		if referrers == nil {
+			return nil
+		}
+		for _, ref := range *referrers {
+			store, ok := ref.(*ssa.Store)
+			if !ok || store.Val != v {
+				continue
+			}
+			if g, ok := store.Addr.(*ssa.Global); ok {
+				if gt, _ := valueRoot(g); gt != nil && types.Identical(gt, t) {
+					return g
+				}
+			}
+		}
+		return nil
+	}
+	if g := storedGlobal(v); g != nil {
+		return g
+	}
+	// A structure value is loaded from its allocation before being stored.
+	if referrers := v.Referrers(); referrers != nil {
+		for _, ref := range *referrers {
+			if load, ok := ref.(*ssa.UnOp); ok && load.Op == token.MUL {
+				if g := storedGlobal(load); g != nil {
+					return g
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// globalInitializers returns the values stored into the global in the init functions of its package.
+func globalInitializers(g *ssa.Global) []ssa.Value {
+	var out []ssa.Value
+	seen := map[*ssa.Function]bool{}
+	var walk func(fn *ssa.Function)
+	walk = func(fn *ssa.Function) {
+		if fn == nil || seen[fn] {
+			return
+		}
+		seen[fn] = true
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				switch instr := instr.(type) {
+				case *ssa.Store:
+					if instr.Addr == g {
+						out = append(out, instr.Val)
+					}
+				case ssa.CallInstruction:
+					// The package initializer calls the init() functions.
+					if callee := instr.Common().StaticCallee(); isInitFunction(callee) && callee.Package() == g.Pkg {
+						walk(callee)
+					}
+				}
+			}
+		}
+	}
+	walk(g.Pkg.Func("init"))
+	return out
+}
@@ -0,0 +1,117 @@
+package usedtype
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Coverage records how many of the exported leaf fields that are reachable from a root type are used.
+type Coverage struct {
+	Total int
+	Used  int
+}
+
+// Percentage returns the percentage of the used leaf fields. It returns 0 if there is no leaf field at all.
+func (c Coverage) Percentage() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(c.Used) / float64(c.Total) * 100
+}
+
+func (c Coverage) String() string {
+	return fmt.Sprintf("%d/%d (%.2f%%)", c.Used, c.Total, c.Percentage())
+}
+
+func (c *Coverage) add(other Coverage) {
+	c.Total += other.Total
+	c.Used += other.Used
+}
+
+type StructCoverages struct {
+	Roots map[StructFullUsageKey]Coverage
+	Total Coverage
+}
+
+type JSONCoverage struct {
+	Total      int     `json:"total"`
+	Used       int     `json:"used"`
+	Percentage float64 `json:"percentage"`
+}
+
+type JSONStructCoverages struct {
+	// Roots is keyed by the string form of the StructFullUsageKey, e.g. "sdk.Model" or "sdk.Interface [sdk.Impl]".
+	Roots map[string]JSONCoverage `json:"roots"`
+	Total JSONCoverage            `json:"total"`
+}
+
+// coverage counts the leaf fields of the nested field trees. A leaf field is regarded as used only if itself and
+// all its ancestor fields are used.
+func (nft StructNestedFieldTrees) coverage(parentUsed bool) Coverage {
+	var c Coverage
+	for _, tree := range nft {
+		used := parentUsed && tree.Used
+		if len(tree.NestedFields) == 0 {
+			c.Total++
+			if used {
+				c.Used++
+			}
+			continue
+		}
+		c.add(tree.NestedFields.coverage(used))
+	}
+	return c
+}
+
+// Coverage returns the field coverage of each struct tree, together with the total coverage among all the trees.
+func (trees StructTrees) Coverage() StructCoverages {
+	out := StructCoverages{
+		Roots: map[StructFullUsageKey]Coverage{},
+	}
+	for k, tree := range trees {
+		c := tree.NestedFields.coverage(true)
+		out.Roots[k] = c
+		out.Total.add(c)
+	}
+	return out
+}
+
+// BuildStructCoverages builds the field coverage for each type in rootSet, see BuildStructTrees for details.
+func BuildStructCoverages(dm StructDirectUsageMap, rootSet NamedTypeAllocSet, opt *StructFullBuildOption) StructCoverages {
+	return BuildStructTrees(dm, rootSet, opt).Coverage()
+}
+
+func (c Coverage) ToJSON() JSONCoverage {
+	return JSONCoverage{
+		Total:      c.Total,
+		Used:       c.Used,
+		Percentage: c.Percentage(),
+	}
+}
+
+func (cs StructCoverages) ToJSON() JSONStructCoverages {
+	out := JSONStructCoverages{
+		Roots: map[string]JSONCoverage{},
+		Total: cs.Total.ToJSON(),
+	}
+	for k, c := range cs.Roots {
+		out.Roots[k.String()] = c.ToJSON()
+	}
+	return out
+}
+
+func (cs StructCoverages) String() string {
+	keys := make(StructFullUsageKeys, 0, len(cs.Roots))
+	for k := range cs.Roots {
+		keys = append(keys, k)
+	}
+	sort.Sort(keys)
+
+	var out []string
+	for _, key := range keys {
+		out = append(out, key.String()+": "+cs.Roots[key].String())
+	}
+	out = append(out, "Total: "+cs.Total.String())
+	return strings.Join(out, "\n")
+}
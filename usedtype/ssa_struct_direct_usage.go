@@ -1,9 +1,11 @@
 package usedtype
 
 import (
+	"context"
 	"fmt"
 	"go/token"
 	"go/types"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -14,6 +16,50 @@ import (
 type VirtAccessPoint struct {
 	Pos   token.Position
 	Instr ssa.Instruction
+	Kind  AccessKind
+
+	// CallStack is the call stack through which the access point is reached from the searched package, which is only
+	// set for the access points found by crossing the package boundary (see StructDirectUsageOption.CrossPackage).
+	CallStack *CallStack
+
+	// value is the structure value (or its address) that is accessed, see accessedValue.
+	value ssa.Value
+}
+
+// StructDirectUsageOption specifies how to search the structure direct usages.
+type StructDirectUsageOption struct {
+	// If non-nil, the search follows the calls from each package into the functions defined in the other packages whose
+	// import path matches it (except the recursive calls, and up to a limited depth), and records the access points
+	// found in there once per call stack. Otherwise, each package is searched on its own.
+	CrossPackage *regexp.Regexp
+
+	// If true, the usages of the unexported fields are also recorded. As the unexported fields can only be accessed in
+	// the package that defines the structure, only the usages in that package are recorded.
+	IncludeUnexported bool
+
+	// Generic specifies how the usages on the instantiated generic types are recorded, see GenericMode.
+	Generic GenericMode
+
+	// GenericContext dedupes the identical instantiations of the generic types, see NewGenericContext.
+	GenericContext *types.Context
+
+	// If non-nil, the fields that are accessed implicitly (e.g. by the decoders via reflection) are also recorded, as
+	// the access kind AccessKindImplicit. See DefaultImplicitUsageModel.
+	ImplicitUsage *ImplicitUsageModel
+}
+
+func (opt *StructDirectUsageOption) genericMode() GenericMode {
+	if opt == nil {
+		return GenericModeNA
+	}
+	return opt.Generic
+}
+
+func (opt *StructDirectUsageOption) genericContext() *types.Context {
+	if opt == nil {
+		return nil
+	}
+	return opt.GenericContext
 }
 
 type StructDirectUsage map[StructField][]VirtAccessPoint
@@ -70,49 +116,163 @@ func (u StructDirectUsageMap) String() string {
 	return strings.Join(out, "\n")
 }
 
-func (m StructDirectUsageMap) record(pkg *packages.Package, instr ssa.Instruction, value ssa.Value, index int) {
+// directUsageRecorder records the virtual access points found by a traversal into the direct usage map.
+type directUsageRecorder struct {
+	m         StructDirectUsageMap
+	fset      *token.FileSet
+	traversal *Traversal
+	opt       *StructDirectUsageOption
+
+	// recorded indexes the recorded access points, which is shared by the recorders of all the packages in a cross
+	// package search. It is nil if the same instruction can't be found more than once.
+	recorded accessPointIndex
+}
+
+// accessPointKey identifies the access on a field by an instruction. An implicit access point (i.e. a call) can access
+// multiple fields.
+type accessPointKey struct {
+	instr ssa.Instruction
+	nt    *types.Named
+	field StructField
+}
+
+// accessPointIndex maps each access to the indexes of its virtual access points (one per call stack) in the field's
+// slice of the direct usage map.
+type accessPointIndex map[accessPointKey][]int
+
+func (r *directUsageRecorder) record(instr ssa.Instruction, value ssa.Value, index int) {
 	t := DereferenceRElem(value.Type())
 	if !IsUnderlyingNamedStruct(t) {
 		return
 	}
-	nt := t.(*types.Named)
+	r.recordField(instr, value, t.(*types.Named), index, InstrAccessKind(instr))
+}
+
+// recordField records the access on the index-th field of the Named structure nt by instr, where value is the
+// structure value (or its address) that is accessed.
+func (r *directUsageRecorder) recordField(instr ssa.Instruction, value ssa.Value, nt *types.Named, index int, kind AccessKind) {
+	m, opt := r.m, r.opt
+	nt = canonicalNamed(nt, opt.genericMode(), opt.genericContext())
 	st := nt.Underlying().(*types.Struct)
 	u := StructField{
 		base:  st,
 		index: index,
 	}
-	// ignore private field
+	// ignore private field, unless required and it is accessed in the defining package
 	if !u.Exported() {
-		return
+		if opt == nil || !opt.IncludeUnexported {
+			return
+		}
+		if fn := instr.Parent(); fn == nil || fn.Package() == nil || fn.Package().Pkg != nt.Obj().Pkg() {
+			return
+		}
 	}
 	if len(m[nt]) == 0 {
 		m[nt] = map[StructField][]VirtAccessPoint{}
 	}
+	// In a cross package search, the same instruction can be found by walking its own package, and by following the
+	// calls from other packages. Record it once per call stack, where the one without call stack is only kept if it is
+	// never reached via a call.
+	stack := r.traversal.CallStack()
+	if r.recorded != nil {
+		k := accessPointKey{instr: instr, nt: nt, field: u}
+		if recorded := r.recorded[k]; len(recorded) != 0 {
+			if stack == nil {
+				return
+			}
+			if first := recorded[0]; m[nt][u][first].CallStack == nil {
+				m[nt][u][first].CallStack = stack
+				return
+			}
+		}
+		r.recorded[k] = append(r.recorded[k], len(m[nt][u]))
+	}
 	m[nt][u] = append(m[nt][u], VirtAccessPoint{
-		Instr: instr,
-		Pos:   InstrPosition(pkg.Fset, instr),
+		Instr:     instr,
+		Pos:       InstrPosition(r.fset, instr),
+		Kind:      kind,
+		CallStack: stack,
+		value:     value,
 	})
 }
 
+// FilterByAccessKind returns a new StructDirectUsageMap that only contains the virtual access points whose access kind
+// includes any of the "kinds". E.g. filtering by AccessKindWrite keeps both the write and the read-modify-write
+// accesses, while filtering by AccessKindReadModifyWrite keeps neither the pure reads nor the pure writes.
+func (m StructDirectUsageMap) FilterByAccessKind(kinds ...AccessKind) StructDirectUsageMap {
+	output := StructDirectUsageMap{}
+	for nt, du := range m {
+		for field, vaps := range du {
+			var filtered []VirtAccessPoint
+			for _, vap := range vaps {
+				for _, kind := range kinds {
+					if vap.Kind&kind == kind {
+						filtered = append(filtered, vap)
+						break
+					}
+				}
+			}
+			if len(filtered) == 0 {
+				continue
+			}
+			if len(output[nt]) == 0 {
+				output[nt] = map[StructField][]VirtAccessPoint{}
+			}
+			output[nt][field] = filtered
+		}
+	}
+	return output
+}
+
 // FindInPackageStructureDirectUsage searches among the ssapkgs to gather each virtual field access on exported fields
 // for each Named struct.
 func FindInPackageStructureDirectUsage(pkgs []*packages.Package, ssapkgs []*ssa.Package) StructDirectUsageMap {
+	return FindInPackageStructureDirectUsageWithOptions(pkgs, ssapkgs, nil)
+}
+
+// FindInPackageStructureDirectUsageWithOptions is like FindInPackageStructureDirectUsage, but is tuned by the opt (e.g.
+// to include the unexported fields), which can be nil.
+func FindInPackageStructureDirectUsageWithOptions(pkgs []*packages.Package, ssapkgs []*ssa.Package, opt *StructDirectUsageOption) StructDirectUsageMap {
+	output, _ := FindInPackageStructureDirectUsageContext(context.Background(), pkgs, ssapkgs, opt)
+	return output
+}
+
+// FindInPackageStructureDirectUsageContext is like FindInPackageStructureDirectUsageWithOptions, but stops once the context is
+// done, and returns a *StageError together with the usages found in the packages that have been walked through.
+func FindInPackageStructureDirectUsageContext(ctx context.Context, pkgs []*packages.Package, ssapkgs []*ssa.Package, opt *StructDirectUsageOption) (StructDirectUsageMap, error) {
 	output := StructDirectUsageMap{}
+	var recorded accessPointIndex
+	if opt != nil && opt.CrossPackage != nil {
+		recorded = accessPointIndex{}
+	}
 	for idx := range ssapkgs {
-		ssapkg := ssapkgs[idx]
-		pkg := pkgs[idx]
-		var cb WalkInstrCallback
-		cb = func(instr ssa.Instruction) {
-			switch instr := instr.(type) {
-			case *ssa.FieldAddr:
-				output.record(pkg, instr, instr.X, instr.Field)
-			case *ssa.Field:
-				output.record(pkg, instr, instr.X, instr.Field)
-			}
+		if err := checkStage(ctx, StageFindDirectUsages); err != nil {
+			return output, err
 		}
 		ssaTraversal := NewTraversal()
-		ssaTraversal.WalkInPackage(ssapkg, cb, nil)
+		if opt != nil && opt.CrossPackage != nil {
+			ssaTraversal = NewCrossPackageTraversal(pkgs[idx].Fset, opt.CrossPackage)
+		}
+		ssaTraversal.WalkInPackage(ssapkgs[idx], output.recordCallback(pkgs[idx].Fset, &ssaTraversal, opt, recorded), nil)
 	}
 
-	return output
+	return output, nil
+}
+
+// recordCallback returns a WalkInstrCallback that records each virtual field access found by the traversal t into
+// the direct usage map. The opt and the recorded index (see directUsageRecorder) can be nil.
+func (m StructDirectUsageMap) recordCallback(fset *token.FileSet, t *Traversal, opt *StructDirectUsageOption, recorded accessPointIndex) WalkInstrCallback {
+	r := &directUsageRecorder{m: m, fset: fset, traversal: t, opt: opt, recorded: recorded}
+	return func(instr ssa.Instruction) {
+		switch instr := instr.(type) {
+		case *ssa.FieldAddr:
+			r.record(instr, instr.X, instr.Field)
+		case *ssa.Field:
+			r.record(instr, instr.X, instr.Field)
+		case ssa.CallInstruction:
+			if opt != nil && opt.ImplicitUsage != nil {
+				r.recordImplicit(instr, opt.ImplicitUsage)
+			}
+		}
+	}
 }
@@ -1,10 +1,15 @@
 package usedtype_test
 
 import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/magodo/usedtype/usedtype"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/ssa"
 )
 
 func TestFindInPackageStructureDirectUsage(t *testing.T) {
@@ -74,3 +79,212 @@ func TestFindInPackageStructureDirectUsage(t *testing.T) {
 		//require.Equal(t, c.expect, "\n"+du.String()+"\n", idx)
 	}
 }
+
+func TestFindInPackageStructureDirectUsageAccessKind(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathAccessKind, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	du := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+
+	accesses := func(du usedtype.StructDirectUsageMap) []string {
+		return accessPoints(du, func(vap usedtype.VirtAccessPoint) string {
+			return vap.Kind.String()
+		})
+	}
+
+	require.Equal(t, []string{
+		"sdk.ModelA.ArrayOfString (array_of_string): address-escaped",
+		"sdk.ModelA.PointerOfProperty (pointer_of_property): read",
+		"sdk.ModelA.Property (property): read-modify-write",
+		"sdk.ModelA.String (string): write",
+		"sdk.Property.Int (int): read",
+		// "x.f++" consists of two FieldAddr instructions, one for read and one for write.
+		"sdk.Property.Int (int): read-modify-write",
+		"sdk.Property.Int (int): read-modify-write",
+	}, accesses(du))
+
+	require.Equal(t, []string{
+		"sdk.ModelA.Property (property): read-modify-write",
+		"sdk.ModelA.String (string): write",
+		"sdk.Property.Int (int): read-modify-write",
+		"sdk.Property.Int (int): read-modify-write",
+	}, accesses(du.FilterByAccessKind(usedtype.AccessKindWrite)))
+
+	// The read-modify-write accesses are neither pure reads nor pure writes.
+	kinds, err := usedtype.ParseAccessKinds("read-modify-write")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"sdk.ModelA.Property (property): read-modify-write",
+		"sdk.Property.Int (int): read-modify-write",
+		"sdk.Property.Int (int): read-modify-write",
+	}, accesses(du.FilterByAccessKind(kinds...)))
+
+	kinds, err = usedtype.ParseAccessKinds("read,address-escaped")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"sdk.ModelA.ArrayOfString (array_of_string): address-escaped",
+		"sdk.ModelA.PointerOfProperty (pointer_of_property): read",
+		"sdk.ModelA.Property (property): read-modify-write",
+		"sdk.Property.Int (int): read",
+		"sdk.Property.Int (int): read-modify-write",
+		"sdk.Property.Int (int): read-modify-write",
+	}, accesses(du.FilterByAccessKind(kinds...)))
+}
+
+func TestFindInPackageStructureDirectUsageCrossPackage(t *testing.T) {
+	accesses := func(du usedtype.StructDirectUsageMap) []string {
+		return accessPoints(du, func(vap usedtype.VirtAccessPoint) string {
+			var stack []string
+			for _, f := range vap.CallStack.Frames() {
+				stack = append(stack, fmt.Sprintf("%s:%d:%d", filepath.Base(f.Pos.Filename), f.Pos.Line, f.Pos.Column))
+			}
+			return fmt.Sprintf("%s:%d [%s]", filepath.Base(vap.Pos.Filename), vap.Pos.Line, strings.Join(stack, " -> "))
+		})
+	}
+
+	cases := []struct {
+		patterns []string
+		opt      *usedtype.StructDirectUsageOption
+		expect   []string
+	}{
+		// 0
+		{
+			[]string{"."},
+			nil,
+			nil,
+		},
+		// 1
+		{
+			[]string{"."},
+			&usedtype.StructDirectUsageOption{CrossPackage: regexp.MustCompile("^a/")},
+			[]string{
+				// The recursive call is not followed.
+				"sdk.ModelA.ArrayOfString (array_of_string): expand.go:26 [main.go:12:21]",
+				"sdk.ModelA.PointerOfProperty (pointer_of_property): expand.go:17 [main.go:11:22]",
+				"sdk.ModelA.PointerOfProperty (pointer_of_property): expand.go:18 [main.go:11:22]",
+				"sdk.ModelA.Property (property): expand.go:9 [main.go:10:15]",
+				"sdk.ModelA.String (string): expand.go:8 [main.go:10:15]",
+				// The helper is reached from both call sites, each one is recorded with its own call stack.
+				"sdk.Property.Int (int): expand.go:13 [main.go:10:15 -> expand.go:9:16]",
+				"sdk.Property.Int (int): expand.go:13 [main.go:11:22 -> expand.go:18:17]",
+			},
+		},
+		// 2: each access point is recorded only once, even though its package is also searched
+		{
+			[]string{".", "./expand"},
+			&usedtype.StructDirectUsageOption{CrossPackage: regexp.MustCompile("^a/")},
+			[]string{
+				"sdk.ModelA.ArrayOfString (array_of_string): expand.go:26 [main.go:12:21]",
+				"sdk.ModelA.PointerOfProperty (pointer_of_property): expand.go:17 [main.go:11:22]",
+				"sdk.ModelA.PointerOfProperty (pointer_of_property): expand.go:18 [main.go:11:22]",
+				"sdk.ModelA.Property (property): expand.go:9 [main.go:10:15]",
+				"sdk.ModelA.String (string): expand.go:8 [main.go:10:15]",
+				"sdk.Property.Int (int): expand.go:13 [main.go:10:15 -> expand.go:9:16]",
+				"sdk.Property.Int (int): expand.go:13 [main.go:11:22 -> expand.go:18:17]",
+			},
+		},
+	}
+
+	for idx, c := range cases {
+		pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathCrossPackage, c.patterns, usedtype.CallGraphTypeNA)
+		require.NoError(t, err, idx)
+		du := usedtype.FindInPackageStructureDirectUsageWithOptions(pkgs, ssapkgs, c.opt)
+		require.Equal(t, c.expect, accesses(du), idx)
+	}
+}
+
+func TestFindInPackageStructureDirectUsageCrossPackageDiamond(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathCrossPackageDiamond, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	du := usedtype.FindInPackageStructureDirectUsageWithOptions(pkgs, ssapkgs, &usedtype.StructDirectUsageOption{CrossPackage: regexp.MustCompile("^a/")})
+
+	var stacks []*usedtype.CallStack
+	require.Equal(t, []string{
+		"sdk.ModelA.Property (property): expand.go:22 [main.go:10:15 -> expand.go:10:13 -> expand.go:18:14]",
+		"sdk.ModelA.Property (property): expand.go:22 [main.go:10:15 -> expand.go:9:12 -> expand.go:14:14]",
+		"sdk.ModelA.String (string): expand.go:36 [main.go:10:15 -> expand.go:10:13 -> expand.go:18:14 -> expand.go:23:11 -> expand.go:28:14]",
+		"sdk.ModelA.String (string): expand.go:36 [main.go:10:15 -> expand.go:10:13 -> expand.go:18:14 -> expand.go:24:14 -> expand.go:32:14]",
+		"sdk.ModelA.String (string): expand.go:36 [main.go:10:15 -> expand.go:9:12 -> expand.go:14:14 -> expand.go:23:11 -> expand.go:28:14]",
+		"sdk.ModelA.String (string): expand.go:36 [main.go:10:15 -> expand.go:9:12 -> expand.go:14:14 -> expand.go:24:14 -> expand.go:32:14]",
+		"sdk.Property.Int (int): expand.go:22 [main.go:10:15 -> expand.go:10:13 -> expand.go:18:14]",
+		"sdk.Property.Int (int): expand.go:22 [main.go:10:15 -> expand.go:9:12 -> expand.go:14:14]",
+	}, accessPoints(du, func(vap usedtype.VirtAccessPoint) string {
+		stacks = append(stacks, vap.CallStack)
+		var frames []string
+		for _, f := range vap.CallStack.Frames() {
+			frames = append(frames, fmt.Sprintf("%s:%d:%d", filepath.Base(f.Pos.Filename), f.Pos.Line, f.Pos.Column))
+		}
+		return fmt.Sprintf("%s:%d [%s]", filepath.Base(vap.Pos.Filename), vap.Pos.Line, strings.Join(frames, " -> "))
+	}))
+
+	// The equal call stacks (and their common prefixes) are the same frames.
+	frames := map[string]*usedtype.CallStack{}
+	for _, stack := range stacks {
+		for f := stack; f != nil; f = f.Caller {
+			if prev, ok := frames[f.String()]; ok {
+				require.Same(t, prev, f, f.String())
+			}
+			frames[f.String()] = f
+		}
+	}
+
+	// Walking the package again reaches the same call stacks.
+	traversal := usedtype.NewCrossPackageTraversal(ssapkgs[0].Prog.Fset, regexp.MustCompile("^a/"))
+	walkedStacks := map[*usedtype.CallStack]struct{}{}
+	for i := 0; i < 2; i++ {
+		traversal.WalkInPackage(ssapkgs[0], func(instr ssa.Instruction) {
+			if instr.Parent().Name() == "expandCommon" {
+				walkedStacks[traversal.CallStack()] = struct{}{}
+			}
+		}, nil)
+	}
+	require.Len(t, walkedStacks, 4)
+}
+
+func TestFindInPackageStructureDirectUsageImplicit(t *testing.T) {
+	accesses := func(du usedtype.StructDirectUsageMap) []string {
+		return accessPoints(du, func(vap usedtype.VirtAccessPoint) string {
+			return fmt.Sprintf("%s:%d [%s]", filepath.Base(vap.Pos.Filename), vap.Pos.Line, vap.Kind)
+		})
+	}
+
+	cases := []struct {
+		opt    *usedtype.StructDirectUsageOption
+		expect []string
+	}{
+		// 0
+		{
+			nil,
+			nil,
+		},
+		// 1
+		{
+			&usedtype.StructDirectUsageOption{ImplicitUsage: usedtype.DefaultImplicitUsageModel()},
+			[]string{
+				"a/model.Base.ID: main.go:16 [implicit]",
+				"a/model.Config.Name (name): main.go:12 [implicit]",
+				"a/model.Config.Nested (nested): main.go:12 [implicit]",
+				"a/model.Config.Tags (tags): main.go:12 [implicit]",
+				"a/model.Nested.Enabled (enabled): main.go:12 [implicit]",
+				"a/model.Reflected.Base: main.go:16 [implicit]",
+				"a/model.Reflected.Kind: main.go:15 [implicit]",
+				"a/model.Tag.Value (value): main.go:12 [implicit]",
+			},
+		},
+		// 2
+		{
+			&usedtype.StructDirectUsageOption{ImplicitUsage: &usedtype.ImplicitUsageModel{FieldByName: true}},
+			[]string{
+				"a/model.Base.ID: main.go:16 [implicit]",
+				"a/model.Reflected.Base: main.go:16 [implicit]",
+				"a/model.Reflected.Kind: main.go:15 [implicit]",
+			},
+		},
+	}
+
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathImplicit, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	for idx, c := range cases {
+		du := usedtype.FindInPackageStructureDirectUsageWithOptions(pkgs, ssapkgs, c.opt)
+		require.Equal(t, c.expect, accesses(du), idx)
+	}
+}
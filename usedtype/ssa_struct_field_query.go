@@ -0,0 +1,268 @@
+package usedtype
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// StructFieldQueryAccessPoint is a virtual access point of a field along the queried path, together with the root
+// allocations that it is reachable from.
+type StructFieldQueryAccessPoint struct {
+	VirtAccessPoint
+
+	// ReachableAllocs are the allocations of the root type that can reach this access point. If there is neither call
+	// graph nor value flow graph specified, all the allocations are regarded as reachable.
+	ReachableAllocs Allocs
+}
+
+// StructFieldQueryStep is one field along the queried path.
+type StructFieldQueryStep struct {
+	// Owner is the Named structure that directly owns the field. In case the field's parent is a Named interface,
+	// this is one of its implementors.
+	Owner        *types.Named
+	Field        StructField
+	AccessPoints []StructFieldQueryAccessPoint
+
+	// Container is the kind of the container (e.g. a map), through which the field holds the owner of the next step.
+	Container ContainerKind
+	// next is the Named structure or interface held by the field, which the next step is resolved against. It is nil
+	// for the last step.
+	next *types.Named
+}
+
+// StructFieldQueryResult is one resolution of the queried path. A query can have multiple resolutions if there is
+// a Named interface along the path, which is resolved to each of its implementors that has the queried field.
+type StructFieldQueryResult struct {
+	Root   *types.Named
+	Allocs Allocs
+	Steps  []StructFieldQueryStep
+}
+
+type StructFieldQueryResults []StructFieldQueryResult
+
+// Path returns the path of the result, in form of "Root.Field1.Field2 [Variant].Field3 [Container].Field4".
+func (r StructFieldQueryResult) Path() string {
+	out := []string{r.Root.String()}
+	parent := r.Root
+	for _, step := range r.Steps {
+		name := step.Field.base.Field(step.Field.index).Name()
+		if IsUnderlyingNamedInterface(parent) {
+			name += " [" + step.Owner.String() + "]"
+		}
+		if step.Container != ContainerKindNone {
+			name += " [" + step.Container.String() + "]"
+		}
+		out = append(out, name)
+		parent = step.next
+	}
+	return strings.Join(out, ".")
+}
+
+func (r StructFieldQueryResult) String() string {
+	out := []string{r.Path()}
+	for _, step := range r.Steps {
+		out = append(out, "  "+step.Owner.String()+": "+step.Field.String())
+		if len(step.AccessPoints) == 0 {
+			out = append(out, "    (not used)")
+		}
+		for _, ap := range step.AccessPoints {
+			out = append(out, fmt.Sprintf("    %s (%s)", ap.Pos, ap.Kind))
+			if len(ap.ReachableAllocs) == 0 {
+				out = append(out, "      unreachable")
+				continue
+			}
+			for _, alloc := range ap.ReachableAllocs {
+				out = append(out, "      reachable from "+alloc.Position.String())
+			}
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func (rs StructFieldQueryResults) String() string {
+	var out []string
+	for _, r := range rs {
+		out = append(out, r.String())
+	}
+	return strings.Join(out, "\n")
+}
+
+// lookupField looks up the field of the Named structure by either its name or its JSON tag name.
+func lookupField(nt *types.Named, name string) (StructField, bool) {
+	st, ok := nt.Underlying().(*types.Struct)
+	if !ok {
+		return StructField{}, false
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i).Name() == name {
+			return StructField{base: st, index: i}, true
+		}
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		field := StructField{base: st, index: i}
+		if tag := field.JSONTag(); tag != "" && tag == name {
+			return field, true
+		}
+	}
+	return StructField{}, false
+}
+
+// lookupRoot finds the root type in rootSet that the query starts with, the root type is identified by either its
+// full name (e.g. "github.com/foo/bar.Baz"), or its package name qualified name (e.g. "bar.Baz"). It returns the
+// root type, and the remaining field names.
+func lookupRoot(rootSet NamedTypeAllocSet, query string) (*types.Named, []string, error) {
+	var (
+		root    *types.Named
+		rootLen int
+	)
+	for nt := range rootSet {
+		names := []string{nt.String()}
+		if pkg := nt.Obj().Pkg(); pkg != nil {
+			names = append(names, pkg.Name()+"."+nt.Obj().Name())
+		}
+		for _, name := range names {
+			if !strings.HasPrefix(query, name+".") || len(name) < rootLen {
+				continue
+			}
+			if len(name) == rootLen && root != nt {
+				return nil, nil, fmt.Errorf("ambiguous type in query %q: %s and %s", query, root, nt)
+			}
+			root, rootLen = nt, len(name)
+		}
+	}
+	if root == nil {
+		return nil, nil, fmt.Errorf("no target type found for query %q", query)
+	}
+	return root, strings.Split(query[rootLen+1:], "."), nil
+}
+
+// resolve resolves the field names against the Named type t, it returns all the resolutions, each of which is a
+// list of steps (without access points).
+func (b *structTreeBuilder) resolve(t *types.Named, names []string) ([][]StructFieldQueryStep, error) {
+	if len(names) == 0 {
+		return [][]StructFieldQueryStep{nil}, nil
+	}
+
+	owners := []*types.Named{t}
+	switch t.Underlying().(type) {
+	case *types.Struct:
+	case *types.Interface:
+		owners = b.implementorsOf(t)
+	default:
+		return nil, fmt.Errorf("%s is neither a structure nor an interface", t)
+	}
+
+	var out [][]StructFieldQueryStep
+	for _, owner := range owners {
+		field, ok := lookupField(owner, names[0])
+		if !ok {
+			continue
+		}
+		step := StructFieldQueryStep{Owner: owner, Field: field}
+		if len(names) == 1 {
+			out = append(out, []StructFieldQueryStep{step})
+			continue
+		}
+		elems := namedElemTypes(field.base.Field(field.index).Type(), b.opt.followFuncResults())
+		if len(elems) == 0 {
+			return nil, fmt.Errorf("field %s of %s is not a named structure or interface", names[0], owner)
+		}
+		// A field can hold multiple structures (e.g. both the key and the value of a map), the path is resolved
+		// against each of them, and fails only if none of them has the remaining fields.
+		var (
+			resolved   bool
+			resolveErr error
+		)
+		for _, elem := range elems {
+			nt := canonicalNamed(elem.Type.(*types.Named), b.opt.genericMode(), b.opt.genericContext())
+			nestedSteps, err := b.resolve(nt, names[1:])
+			if err != nil {
+				resolveErr = err
+				continue
+			}
+			step := step
+			step.Container = elem.Kind
+			step.next = nt
+			resolved = true
+			for _, steps := range nestedSteps {
+				out = append(out, append([]StructFieldQueryStep{step}, steps...))
+			}
+		}
+		if !resolved {
+			return nil, resolveErr
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no field %s found in %s", names[0], t)
+	}
+	return out, nil
+}
+
+// QueryStructField resolves the field path (e.g. "pkg.Type.Field1.Field2") against the types in rootSet, and returns
+// the virtual access points of each field along the path, together with their reachability from each allocation of
+// the root type.
+// Each field in the path can be specified by either its name or its JSON tag name. The fields of type pointer, array,
+// slice, map and channel are followed to the types they hold (see ElemTypes).
+func QueryStructField(dm StructDirectUsageMap, rootSet NamedTypeAllocSet, query string, opt *StructFullBuildOption) (StructFieldQueryResults, error) {
+	root, names, err := lookupRoot(rootSet, query)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &structTreeBuilder{
+		dm:           dm,
+		opt:          opt,
+		implementors: map[*types.Named][]*types.Named{},
+	}
+	resolutions, err := b.resolve(root, names)
+	if err != nil {
+		return nil, err
+	}
+
+	allocs := make(Allocs, 0, len(rootSet[root]))
+	for alloc := range rootSet[root] {
+		allocs = append(allocs, alloc)
+	}
+	sort.Sort(allocs)
+
+	reach := newReachabilityIndex(opt)
+	roots := make([]*rootContext, 0, len(allocs))
+	for _, alloc := range allocs {
+		roots = append(roots, newRootContext(alloc, opt, reach))
+	}
+
+	var out StructFieldQueryResults
+	for _, steps := range resolutions {
+		// The contexts of each root at the current step
+		ctxs := append([]*rootContext{}, roots...)
+		for i, step := range steps {
+			reached := make([][]VirtAccessPoint, len(ctxs))
+			vaps := dm[step.Owner][step.Field]
+			for _, vap := range vaps {
+				ap := StructFieldQueryAccessPoint{VirtAccessPoint: vap}
+				for j, ctx := range ctxs {
+					if !ctx.reaches(vap, opt) {
+						continue
+					}
+					ap.ReachableAllocs = append(ap.ReachableAllocs, ctx.alloc)
+					reached[j] = append(reached[j], vap)
+				}
+				steps[i].AccessPoints = append(steps[i].AccessPoints, ap)
+			}
+			sort.Slice(steps[i].AccessPoints, func(m, n int) bool {
+				return steps[i].AccessPoints[m].Pos.String() < steps[i].AccessPoints[n].Pos.String()
+			})
+			for j, ctx := range ctxs {
+				ctxs[j] = ctx.nested(reached[j], opt)
+			}
+		}
+		out = append(out, StructFieldQueryResult{
+			Root:   root,
+			Allocs: allocs,
+			Steps:  steps,
+		})
+	}
+	return out, nil
+}
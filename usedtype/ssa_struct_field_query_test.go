@@ -0,0 +1,41 @@
+package usedtype_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/magodo/usedtype/usedtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryStructField(t *testing.T) {
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathA, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	rootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+	dm := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	opt := &usedtype.StructFullBuildOption{Callgraph: graph}
+
+	// Fields can be specified by either the name or the JSON tag name
+	for _, query := range []string{"sdk.ModelA.Property.Int", "sdk.ModelA.property.int"} {
+		results, err := usedtype.QueryStructField(dm, rootSet, query, opt)
+		require.NoError(t, err)
+		expect := `
+sdk.ModelA.Property.Int
+  sdk.ModelA: Property (property)
+    %[1]s/main.go:13:6 (write)
+      reachable from %[1]s/main.go:8:19
+      reachable from %[1]s/main.go:8:2
+  sdk.Property: Int (int)
+    %[1]s/main.go:30:25 (write)
+      reachable from %[1]s/main.go:8:19
+      reachable from %[1]s/main.go:8:2
+`
+		require.Equal(t, strings.TrimSpace(strings.ReplaceAll(expect, "%[1]s", pathA)), results.String())
+	}
+
+	_, err = usedtype.QueryStructField(dm, rootSet, "sdk.ModelA.NotExist", opt)
+	require.Error(t, err)
+	_, err = usedtype.QueryStructField(dm, rootSet, "sdk.NotExist.Property", opt)
+	require.Error(t, err)
+}
@@ -1,23 +1,19 @@
 package usedtype
 
 import (
+	"context"
+	"go/token"
 	"go/types"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
 
 	log "github.com/sirupsen/logrus"
 
-	"golang.org/x/tools/go/callgraph"
 	"golang.org/x/tools/go/ssa"
 )
 
-var verbose bool
-
-func SetStructFieldUsageVerbose(enabled bool) {
-	verbose = enabled
-}
-
 type StructFullUsageKey struct {
 	Named   *types.Named
 	Variant *types.Named // non-nil only when Named is a Named interface_property
@@ -28,6 +24,22 @@ type StructFullUsageKeys []StructFullUsageKey
 type StructFieldFullUsageKey struct {
 	StructField
 	Variant *types.Named // non-nil only when the StructField corresponds to an interface_property
+
+	// Container is the kind of the container (e.g. a map), through which the field holds the nested structure or
+	// interface. It is ContainerKindNone for the fields that hold it directly, or via pointers, arrays and slices.
+	Container ContainerKind
+	// elem is the nested structure or interface held by the field through the Container. It is nil if Container is
+	// ContainerKindNone.
+	elem *types.Named
+
+	// Via is the dot separated names of the embedded fields, through which the StructField is promoted to the outer
+	// structure. It is only set when the embedded fields are collapsed (see StructFullBuildOption.CollapseEmbedded).
+	Via string
+	// viaIndex is the index (plus one) of the outermost embedded field in Via, which is used to sort the promoted
+	// fields among the fields of the outer structure. It is 0 if Via is empty.
+	viaIndex int
+	// owner is the embedded structure that owns the promoted field. It is nil if Via is empty.
+	owner *types.Named
 }
 
 type StructFieldFullUsageKeys []StructFieldFullUsageKey
@@ -54,7 +66,9 @@ type StructFullUsage struct {
 type StructFullUsageAmongAlloc map[Alloc]StructFullUsage
 
 type StructFullUsages struct {
-	dm               StructDirectUsageMap
+	dm StructDirectUsageMap
+	// reach is the reachability index of the call graph, which is shared among all the roots.
+	reach            *reachabilityIndex
 	UsagesAmongAlloc map[StructFullUsageKey]StructFullUsageAmongAlloc
 }
 
@@ -79,9 +93,43 @@ func (keys StructFieldFullUsageKeys) Swap(i, j int) {
 }
 
 func (keys StructFieldFullUsageKeys) Less(i, j int) bool {
-	return keys[i].index < keys[j].index ||
-		(keys[i].index == keys[j].index &&
-			keys[i].Variant.String() < keys[j].Variant.String())
+	if oi, oj := keys[i].outerIndex(), keys[j].outerIndex(); oi != oj {
+		return oi < oj
+	}
+	if keys[i].Via != keys[j].Via {
+		return keys[i].Via < keys[j].Via
+	}
+	if keys[i].index != keys[j].index {
+		return keys[i].index < keys[j].index
+	}
+	if keys[i].Container != keys[j].Container {
+		return keys[i].Container < keys[j].Container
+	}
+	return keys[i].Variant.String() < keys[j].Variant.String()
+}
+
+// outerIndex returns the index of the field in the outer structure, which is the index of the outermost embedded
+// field for a promoted field.
+func (key StructFieldFullUsageKey) outerIndex() int {
+	if key.viaIndex != 0 {
+		return key.viaIndex - 1
+	}
+	return key.index
+}
+
+// promote returns the key of the field promoted through the embedded field.
+func (key StructFieldFullUsageKey) promote(embedded StructField) StructFieldFullUsageKey {
+	name := embedded.base.Field(embedded.index).Name()
+	if key.Via == "" {
+		key.Via = name
+	} else {
+		key.Via = name + "." + key.Via
+	}
+	key.viaIndex = embedded.index + 1
+	if key.owner == nil {
+		key.owner, _ = embedded.DereferenceRElem().(*types.Named)
+	}
+	return key
 }
 
 func (key StructFullUsageKey) String() string {
@@ -92,15 +140,27 @@ func (key StructFullUsageKey) String() string {
 }
 
 func (key StructFieldFullUsageKey) String() string {
-	if key.Variant == nil {
-		return key.StructField.String()
+	out := key.StructField.String()
+	if key.Container != ContainerKindNone {
+		out += " [" + key.Container.String() + "]"
+	}
+	if key.Variant != nil {
+		out += " [" + key.Variant.String() + "]"
+	}
+	if key.Via != "" {
+		out += " (via " + key.Via + ")"
 	}
-	return key.StructField.String() + " [" + key.Variant.String() + "]"
+	return out
 }
 
 func (fu StructFullUsage) String() string {
+	return fu.Render(nil)
+}
+
+// Render renders the StructFullUsage as text, the opt can be nil.
+func (fu StructFullUsage) Render(opt *StructFullRenderOption) string {
 	var out = []string{fu.Key.String()}
-	if verbose {
+	if opt.verbose() {
 		out = append(out, fu.Alloc.Position.String())
 	}
 
@@ -113,12 +173,17 @@ func (fu StructFullUsage) String() string {
 	sort.Sort(keys)
 
 	for _, key := range keys {
-		out = append(out, fu.NestedFields[key].stringWithIndent(2))
+		out = append(out, fu.NestedFields[key].renderWithIndent(2, opt))
 	}
 	return strings.Join(out, "\n")
 }
 
 func (fus StructFullUsages) String() string {
+	return fus.Render(nil)
+}
+
+// Render renders the StructFullUsages as text, the opt can be nil.
+func (fus StructFullUsages) Render(opt *StructFullRenderOption) string {
 	keys := make(StructFullUsageKeys, 0, len(fus.UsagesAmongAlloc))
 	for k := range fus.UsagesAmongAlloc {
 		keys = append(keys, k)
@@ -129,12 +194,12 @@ func (fus StructFullUsages) String() string {
 	for _, key := range keys {
 		usageAmongAlloc := fus.UsagesAmongAlloc[key]
 
-		if !verbose {
+		if !opt.verbose() {
 			fu := usageAmongAlloc.Flatten()
 			if fu == nil {
 				continue
 			}
-			out = append(out, fu.String())
+			out = append(out, fu.Render(opt))
 			continue
 		}
 
@@ -146,24 +211,33 @@ func (fus StructFullUsages) String() string {
 		sort.Sort(allocs)
 
 		for _, alloc := range allocs {
-			out = append(out, usageAmongAlloc[alloc].String())
+			out = append(out, usageAmongAlloc[alloc].Render(opt))
 		}
 	}
 	return strings.Join(out, "\n")
 }
 
 func (ffu StructFieldFullUsage) String() string {
-	return ffu.stringWithIndent(0)
+	return ffu.Render(nil)
 }
 
-func (ffu StructFieldFullUsage) stringWithIndent(ident int) string {
+// Render renders the StructFieldFullUsage as text, the opt can be nil.
+func (ffu StructFieldFullUsage) Render(opt *StructFullRenderOption) string {
+	return ffu.renderWithIndent(0, opt)
+}
+
+func (ffu StructFieldFullUsage) renderWithIndent(ident int, opt *StructFullRenderOption) string {
 	prefix := strings.Repeat("  ", ident)
 	var out = []string{prefix + ffu.Key.String()}
 
-	if verbose {
+	if opt.verbose() {
 		positions := make([]string, 0, len(ffu.VirtAccessPoints))
 		for vnode := range ffu.VirtAccessPoints {
-			positions = append(positions, prefix+"  "+vnode.Pos.String())
+			pos := prefix + "  " + vnode.Pos.String()
+			if vnode.CallStack != nil {
+				pos += " (called from " + vnode.CallStack.String() + ")"
+			}
+			positions = append(positions, pos)
 		}
 		out = append(out, positions...)
 	}
@@ -177,7 +251,7 @@ func (ffu StructFieldFullUsage) stringWithIndent(ident int) string {
 	sort.Sort(keys)
 
 	for _, key := range keys {
-		out = append(out, ffu.NestedFields[key].stringWithIndent(ident+2))
+		out = append(out, ffu.NestedFields[key].renderWithIndent(ident+2, opt))
 	}
 	return strings.Join(out, "\n")
 }
@@ -207,8 +281,127 @@ func (ffu StructFieldFullUsage) copy() StructFieldFullUsage {
 	}
 }
 
+// rootContext is the context of building the full usage of one root.
+type rootContext struct {
+	alloc Alloc
+
+	// reach is the reachability index of the call graph. It is nil if the call graph is not specified.
+	reach *reachabilityIndex
+
+	// flow is the set of values that the root instance flows to. It is nil if value flow is not enabled.
+	flow map[ssa.Value]struct{}
+
+	// sites are the allocation sites of the instances at the current nesting level, i.e. the root instance and the
+	// instances nested in it. It is nil if points-to is not enabled, or the root has no points-to information.
+	sites allocSites
+}
+
+func newRootContext(alloc Alloc, opt *StructFullBuildOption, reach *reachabilityIndex) *rootContext {
+	ctx := &rootContext{alloc: alloc, reach: reach}
+	if opt != nil && opt.ValueFlow != nil {
+		ctx.flow = opt.ValueFlow.Flow(alloc.Value)
+	}
+	if opt != nil && opt.PointsTo != nil {
+		ctx.sites, _ = opt.PointsTo.rootSitesOf(alloc)
+	}
+	return ctx
+}
+
+// nested returns the context for the nested fields of a field, which is accessed by the given virtual access points.
+func (ctx *rootContext) nested(vaps []VirtAccessPoint, opt *StructFullBuildOption) *rootContext {
+	if ctx.sites == nil {
+		return ctx
+	}
+	// The objects of the nested structures are either the same ones (i.e. for the value typed fields), or the ones
+	// that the fields point to.
+	sites := allocSites{}
+	for v := range ctx.sites {
+		sites[v] = struct{}{}
+	}
+	for _, vap := range vaps {
+		// The implicit access points (i.e. calls) have no field value, whose nested structures are the ones of the
+		// accessed argument.
+		v, ok := vap.Instr.(ssa.Value)
+		if !ok {
+			continue
+		}
+		for v := range opt.PointsTo.contents[v] {
+			sites[v] = struct{}{}
+		}
+	}
+	return &rootContext{
+		alloc: ctx.alloc,
+		reach: ctx.reach,
+		flow:  ctx.flow,
+		sites: sites,
+	}
+}
+
+// reaches checks whether the virtual access point can be tracked from the root.
+func (ctx *rootContext) reaches(vap VirtAccessPoint, opt *StructFullBuildOption) bool {
+	if opt == nil {
+		return true
+	}
+	if ctx.reach != nil && !checkInstructionReachability(ctx.alloc.Instr, vap.Instr, ctx.reach) {
+		return false
+	}
+	if ctx.flow != nil {
+		if _, ok := ctx.flow[accessedValue(vap)]; !ok {
+			return false
+		}
+	}
+	if ctx.sites != nil {
+		if sites, ok := opt.PointsTo.allocSitesOf(accessedValue(vap)); ok && !sites.intersects(ctx.sites) {
+			return false
+		}
+	}
+	return true
+}
+
+// directAccessPoints returns the access points that access the field directly, rather than only selecting the fields
+// of the structure it holds (e.g. to reach the promoted fields through an embedded field). Unless recordAll is set,
+// only the first one is returned.
+func directAccessPoints(vaps []VirtAccessPoint, recordAll bool) map[VirtAccessPoint]struct{} {
+	out := map[VirtAccessPoint]struct{}{}
+	for _, vap := range vaps {
+		if v, ok := vap.Instr.(ssa.Value); ok && onlySelectsFields(v) {
+			continue
+		}
+		out[vap] = struct{}{}
+		if !recordAll {
+			break
+		}
+	}
+	return out
+}
+
+// onlySelectsFields checks whether the value is only used to select the fields of the structure it holds (or points
+// to, possibly after loading).
+func onlySelectsFields(v ssa.Value) bool {
+	referrers := v.Referrers()
+	if referrers == nil {
+		return false
+	}
+	n := 0
+	for _, ref := range *referrers {
+		switch ref := ref.(type) {
+		case *ssa.DebugRef:
+			continue
+		case *ssa.FieldAddr, *ssa.Field:
+		case *ssa.UnOp:
+			if ref.Op != token.MUL || !onlySelectsFields(ref) {
+				return false
+			}
+		default:
+			return false
+		}
+		n++
+	}
+	return n != 0
+}
+
 // build build nested fields for a given Named structure or Named interface (baseStruct).
-func (nsf StructNestedFields) build(dm StructDirectUsageMap, baseStruct *types.Named, seenStructures map[*types.Named]struct{}, origin Alloc, opt *StructFullBuildOption) {
+func (nsf StructNestedFields) build(dm StructDirectUsageMap, baseStruct *types.Named, seenStructures map[*types.Named]struct{}, root *rootContext, opt *StructFullBuildOption) {
 	if _, ok := seenStructures[baseStruct]; ok {
 		return
 	}
@@ -219,23 +412,31 @@ func (nsf StructNestedFields) build(dm StructDirectUsageMap, baseStruct *types.N
 		return
 	}
 
+	recordAll := opt.recordAllAccessPoints()
 	for nestedField, vaps := range du {
-		nestedFieldType := nestedField.DereferenceRElem()
 		vAccessPoints := make(map[VirtAccessPoint]struct{})
+		collapse := opt != nil && opt.CollapseEmbedded && nestedField.Embedded()
 
 		// Check whether this virtual access can be tracked from the original virtual access point
+		var reached []VirtAccessPoint
 		for _, vap := range vaps {
-			if opt != nil && opt.Callgraph != nil {
-				if !checkInstructionReachability(origin.Instr, vap.Instr, opt.Callgraph) {
-					continue
-				}
+			if !root.reaches(vap, opt) {
+				continue
 			}
-			vAccessPoints[vap] = struct{}{}
-			// In non-verbose mode, there is no need to record all vaps, only one is enough.
-			if !verbose {
+			reached = append(reached, vap)
+			// Unless required, there is no need to record all vaps, only one is enough. Unless all of them are
+			// needed to track the nested instances, or to tell the direct accesses of a collapsed embedded field.
+			if !recordAll && root.sites == nil && !collapse {
+				break
+			}
+		}
+		for i, vap := range reached {
+			if !recordAll && i > 0 {
 				break
 			}
+			vAccessPoints[vap] = struct{}{}
 		}
+		nestedRoot := root.nested(reached, opt)
 
 		if len(vAccessPoints) == 0 {
 			continue
@@ -248,7 +449,8 @@ func (nsf StructNestedFields) build(dm StructDirectUsageMap, baseStruct *types.N
 			VirtAccessPoints: vAccessPoints,
 		}
 
-		if !IsElemUnderlyingNamedStructOrInterface(nestedFieldType) {
+		elems := namedElemTypes(nestedField.base.Field(nestedField.index).Type(), opt.followFuncResults())
+		if len(elems) == 0 {
 			k := StructFieldFullUsageKey{
 				StructField: nestedField,
 			}
@@ -257,88 +459,93 @@ func (nsf StructNestedFields) build(dm StructDirectUsageMap, baseStruct *types.N
 			continue
 		}
 
-		nt := nestedFieldType.(*types.Named)
-		switch t := nt.Underlying().(type) {
-		case *types.Interface:
-			for du := range dm {
-				if opt != nil && opt.CustomImplements != nil {
-					if !opt.CustomImplements(du, nt) {
+		for _, elem := range elems {
+			nt := canonicalNamed(elem.Type.(*types.Named), opt.genericMode(), opt.genericContext())
+			var elemNamed *types.Named
+			if elem.Kind != ContainerKindNone {
+				elemNamed = nt
+			}
+			switch t := nt.Underlying().(type) {
+			case *types.Interface:
+				for du := range dm {
+					// Whether an uninstantiated generic type implements an interface is unspecified.
+					if du.TypeParams().Len() != 0 {
 						continue
 					}
-				} else {
-					if !types.Implements(du, t) {
-						continue
+					if opt != nil && opt.CustomImplements != nil {
+						if !opt.CustomImplements(du, nt) {
+							continue
+						}
+					} else {
+						if !types.Implements(du, t) {
+							continue
+						}
+					}
+					ffu := ffu.copy()
+					k := StructFieldFullUsageKey{
+						StructField: nestedField,
+						Variant:     du,
+						Container:   elem.Kind,
+						elem:        elemNamed,
 					}
+					ffu.Key = k
+					ffu.NestedFields.build(dm, du, ffu.seenStructures, nestedRoot, opt)
+					nsf[k] = ffu
 				}
+			case *types.Struct:
 				ffu := ffu.copy()
 				k := StructFieldFullUsageKey{
 					StructField: nestedField,
-					Variant:     du,
+					Container:   elem.Kind,
+					elem:        elemNamed,
 				}
 				ffu.Key = k
-				ffu.NestedFields.build(dm, du, ffu.seenStructures, origin, opt)
+				ffu.NestedFields.build(dm, nt, ffu.seenStructures, nestedRoot, opt)
+				// Collapse the used fields of the embedded structure into the current one, as the promoted fields. The
+				// embedded field itself is kept only if none of its fields is used, or it is accessed directly (e.g.
+				// assigned), in which case it keeps the direct accesses only.
+				if collapse && len(ffu.NestedFields) != 0 {
+					for k, nffu := range ffu.NestedFields {
+						nffu.Key = k.promote(nestedField)
+						nsf[nffu.Key] = nffu
+					}
+					if direct := directAccessPoints(reached, recordAll); len(direct) != 0 {
+						ffu.NestedFields = map[StructFieldFullUsageKey]StructFieldFullUsage{}
+						ffu.VirtAccessPoints = direct
+						nsf[k] = ffu
+					}
+					continue
+				}
 				nsf[k] = ffu
+			default:
+				panic("will never happen")
 			}
-		case *types.Struct:
-			ffu := ffu.copy()
-			k := StructFieldFullUsageKey{
-				StructField: nestedField,
-			}
-			ffu.Key = k
-			ffu.NestedFields.build(dm, nt, ffu.seenStructures, origin, opt)
-			nsf[k] = ffu
-		default:
-			panic("will never happen")
 		}
 	}
 }
 
-// checkInstructionReachability checks whether two instructions can reach the other in either direction.
-// Ideally, for a read field access, we should ensure the root structure can reach the child field's read;
-// Otherwise, for a write field access, we should ensure the write of the child field happens first.
-// However, it is non-trivial in SSA to determine whether one instruction (Field/FieldAddr) is for a later read or write.
-// Practically, we ignore this difference here, but simply check whether two instructions can reach the other in either direction.
-func checkInstructionReachability(i1, i2 ssa.Instruction, graph *callgraph.Graph) bool {
-	if i1.Block() == i2.Block() {
-		return true
-	}
-	if i1.Parent() == i2.Parent() {
-		i1CanReachI2, i2CanReachI1 := BBCanReach(i1.Block(), i2.Block()), BBCanReach(i2.Block(), i1.Block())
-		return i1CanReachI2 || i2CanReachI1
-	}
-
-	// In case n1 can reach n2, it only means the function enclosing i1 has at least one
-	// path that calls the function enclosing i2.
-	// TODO: we should ensure the i1 can reach the callsite. We didn't do it here for now
-	// since `callgraph.PathSearch` only returns an arbitrary path, whilst we should check
-	// all possible paths.
-	n1 := graph.Nodes[i1.Parent()]
-	n2 := graph.Nodes[i2.Parent()]
-
-	// For some whole program algorithms (e.g. rta), the callgraph only contains the subset of functions that reachable from main().
-	// If the instruction here isn't reachable from main, then we should regard them as not reachable.
-	if n1 == nil || n2 == nil {
-		return false
-	}
-
-	paths1to2 := callgraph.PathSearch(n1, func(n *callgraph.Node) bool {
-		return n == n2
-	})
-	paths2to1 := callgraph.PathSearch(n2, func(n *callgraph.Node) bool {
-		return n == n1
-	})
-	return len(paths1to2) != 0 || len(paths2to1) != 0
+// structFullBuildJob builds the full usages of a root among its allocations.
+type structFullBuildJob struct {
+	key      StructFullUsageKey
+	allocSet AllocSet
+	named    *types.Named
+	usages   StructFullUsageAmongAlloc
 }
 
-// buildUsagesAmongAlloc build usages for one Named type, which is either a structure or an interface. In case of interface, it will
+// buildUsagesAmongAllocJobs returns the jobs to build usages for one Named type, which is either a structure or an interface. In case of interface, it will
 // build for all its implementors.
 // The meaning of "build usages" here means to regard the input type as the root structure, recursively iterate its fields to
 // check whether the virtual access from this type to this field occurs in the direct usage map.
-func (us StructFullUsages) buildUsagesAmongAlloc(wg *sync.WaitGroup, root *types.Named, allocSet AllocSet, opt *StructFullBuildOption) {
+func (us StructFullUsages) buildUsagesAmongAllocJobs(root *types.Named, allocSet AllocSet, opt *StructFullBuildOption) []structFullBuildJob {
 	// If the target Named type is an interface_property, we shall do the full usage processing
 	// on each of its variants that appear in the direct usage map.
 	if iRoot, ok := root.Underlying().(*types.Interface); ok {
+		var jobs []structFullBuildJob
 		for named := range us.dm {
+			// Whether an uninstantiated generic type implements an interface is unspecified.
+			if named.TypeParams().Len() != 0 {
+				continue
+			}
 			if opt != nil && opt.CustomImplements != nil {
 				if !opt.CustomImplements(named, root) {
 					continue
@@ -352,45 +559,55 @@ func (us StructFullUsages) buildUsagesAmongAlloc(wg *sync.WaitGroup, root *types
 				Named:   root,
 				Variant: named,
 			}
-			us.buildUsagesAmongAllocForStructure(wg, k, allocSet, named, opt)
+			jobs = append(jobs, us.newBuildJob(k, allocSet, named))
 		}
-		return
+		return jobs
 	}
 
 	if _, ok := us.dm[root]; !ok {
-		return
+		return nil
 	}
 
 	k := StructFullUsageKey{
 		Named: root,
 	}
-	us.buildUsagesAmongAllocForStructure(wg, k, allocSet, root, opt)
-	return
+	return []structFullBuildJob{us.newBuildJob(k, allocSet, root)}
 }
 
-func (us StructFullUsages) buildUsagesAmongAllocForStructure(wg *sync.WaitGroup, k StructFullUsageKey, allocSet AllocSet, named *types.Named, opt *StructFullBuildOption) {
+func (us StructFullUsages) newBuildJob(k StructFullUsageKey, allocSet AllocSet, named *types.Named) structFullBuildJob {
 	usageAmongAlloc := StructFullUsageAmongAlloc{}
 	us.UsagesAmongAlloc[k] = usageAmongAlloc
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for alloc := range allocSet {
-			fu := StructFullUsage{
-				dm:           us.dm,
-				Key:          k,
-				Alloc:        alloc,
-				NestedFields: map[StructFieldFullUsageKey]StructFieldFullUsage{},
-			}
-			usageAmongAlloc[alloc] = fu
-			fu.NestedFields.build(us.dm, named, map[*types.Named]struct{}{}, alloc, opt)
+	return structFullBuildJob{
+		key:      k,
+		allocSet: allocSet,
+		named:    named,
+		usages:   usageAmongAlloc,
+	}
+}
+
+// runBuildJob builds the full usages of each allocation of the job. It returns false if the context is done before
+// all of them are built.
+func (us StructFullUsages) runBuildJob(ctx context.Context, job structFullBuildJob, opt *StructFullBuildOption) bool {
+	for alloc := range job.allocSet {
+		if ctx.Err() != nil {
+			return false
+		}
+		fu := StructFullUsage{
+			dm:           us.dm,
+			Key:          job.key,
+			Alloc:        alloc,
+			NestedFields: map[StructFieldFullUsageKey]StructFieldFullUsage{},
 		}
-		log.Debugf("finish %s\n", named.String())
-	}()
+		job.usages[alloc] = fu
+		fu.NestedFields.build(us.dm, job.named, map[*types.Named]struct{}{}, newRootContext(alloc, opt, us.reach), opt)
+	}
+	log.Debugf("finish %s\n", job.named.String())
+	return true
 }
 
 // Flatten merges all instances of StructFullUsage of a struct appear in different Alloc into one.
 // The returned StructFullUsage only has Key and NestedFields filled. Hence it will not show verbose information even
-// if verbose is enabled.
+// if rendered in verbose mode.
 func (amongAlloc StructFullUsageAmongAlloc) Flatten() *StructFullUsage {
 	var out *StructFullUsage
 	for _, fu := range amongAlloc {
@@ -407,7 +624,7 @@ func (amongAlloc StructFullUsageAmongAlloc) Flatten() *StructFullUsage {
 
 	// Flatten a field full usage into a StructNestedFields, together with the field's nested fields.
 	// Only the Key, and the NestedFields will be kept as a result, the VirtAccessPoints will be thrown away.
-	// Hence it will not show verbose information even if verbose is enabled.
+	// Hence it will not show verbose information even if rendered in verbose mode.
 	var flattenNestedFields func(nestedFields StructNestedFields, k StructFieldFullUsageKey, ffu StructFieldFullUsage)
 	flattenNestedFields = func(nestedFields StructNestedFields, k StructFieldFullUsageKey, ffu StructFieldFullUsage) {
 		nfs, ok := nestedFields[k]
@@ -436,16 +653,83 @@ func (amongAlloc StructFullUsageAmongAlloc) Flatten() *StructFullUsage {
 // that is implemented by some structures. It only extends the properties (of type structure) when the
 // property is directly referenced somewhere, i.e. appears in "dm".
 func BuildStructFullUsages(dm StructDirectUsageMap, rootSet NamedTypeAllocSet, opt *StructFullBuildOption) StructFullUsages {
+	us, _ := BuildStructFullUsagesContext(context.Background(), dm, rootSet, opt)
+	return us
+}
+
+// BuildStructFullUsagesContext is like BuildStructFullUsages, but stops once the context is done, and returns a
+// *StageError together with the full usages of the roots that have been completely built.
+func BuildStructFullUsagesContext(ctx context.Context, dm StructDirectUsageMap, rootSet NamedTypeAllocSet, opt *StructFullBuildOption) (StructFullUsages, error) {
 	us := StructFullUsages{
 		dm:               dm,
+		reach:            newReachabilityIndex(opt),
 		UsagesAmongAlloc: map[StructFullUsageKey]StructFullUsageAmongAlloc{},
 	}
 
-	var wg sync.WaitGroup
+	var jobs []structFullBuildJob
 	for root, allocSet := range rootSet {
-		log.Debugf("building %s\n", root.String())
-		us.buildUsagesAmongAlloc(&wg, root, allocSet, opt)
+		jobs = append(jobs, us.buildUsagesAmongAllocJobs(root, allocSet, opt)...)
 	}
+
+	concurrency := runtime.GOMAXPROCS(0)
+	var progress StructFullBuildProgress
+	if opt != nil {
+		if opt.Concurrency > 0 {
+			concurrency = opt.Concurrency
+		}
+		progress = opt.Progress
+	}
+
+	jobCh := make(chan structFullBuildJob)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+		// The jobs that are interrupted
+		unfinished []StructFullUsageKey
+	)
+	for i := 0; i < concurrency && i < len(jobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				if !us.runBuildJob(ctx, job, opt) {
+					mu.Lock()
+					unfinished = append(unfinished, job.key)
+					mu.Unlock()
+					continue
+				}
+				if progress != nil {
+					mu.Lock()
+					done++
+					progress(done, len(jobs), job.named)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	var notStarted []structFullBuildJob
+dispatch:
+	for i, job := range jobs {
+		log.Debugf("building %s\n", job.named.String())
+		select {
+		case jobCh <- job:
+		case <-ctx.Done():
+			notStarted = jobs[i:]
+			break dispatch
+		}
+	}
+	close(jobCh)
 	wg.Wait()
-	return us
+	for _, job := range notStarted {
+		unfinished = append(unfinished, job.key)
+	}
+
+	if len(unfinished) == 0 {
+		return us, nil
+	}
+	for _, k := range unfinished {
+		delete(us.UsagesAmongAlloc, k)
+	}
+	return us, checkStage(ctx, StageBuildFullUsages)
 }
@@ -0,0 +1,184 @@
+package usedtype
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StructFieldUsageEntry identifies one used field in a StructFullUsages, by the root type that the field is extended
+// from, and the path of fields from the root.
+type StructFieldUsageEntry struct {
+	// Root is the root type, in form of "Named" or "Named [Variant]".
+	Root string
+	// Path is the path of fields from the root, in form of "Field1.Field2 [Variant].Field3".
+	Path string
+
+	// Owner is the named type that directly owns the field.
+	Owner string
+	// Field is the name of the field.
+	Field string
+}
+
+func (e StructFieldUsageEntry) String() string {
+	return e.Root + ": " + e.Path
+}
+
+// fieldID identifies a field by type and field identity, regardless of which root it is extended from.
+func (e StructFieldUsageEntry) fieldID() string {
+	return e.Owner + "." + e.Field
+}
+
+type StructFieldUsageEntries []StructFieldUsageEntry
+
+func (es StructFieldUsageEntries) Len() int {
+	return len(es)
+}
+
+func (es StructFieldUsageEntries) Swap(i, j int) {
+	es[i], es[j] = es[j], es[i]
+}
+
+func (es StructFieldUsageEntries) Less(i, j int) bool {
+	return es[i].Root < es[j].Root || (es[i].Root == es[j].Root && es[i].Path < es[j].Path)
+}
+
+// StructFieldUsageMove represents a field that stops being used from one root (or path), but becomes used from another.
+type StructFieldUsageMove struct {
+	From StructFieldUsageEntry
+	To   StructFieldUsageEntry
+}
+
+type StructFullUsagesDiff struct {
+	// Added are the fields that become used.
+	Added StructFieldUsageEntries
+	// Removed are the fields that stop being used.
+	Removed StructFieldUsageEntries
+	// Moved are the fields that are used from a different root (or path).
+	Moved []StructFieldUsageMove
+}
+
+func (d StructFullUsagesDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Moved) == 0
+}
+
+func (d StructFullUsagesDiff) String() string {
+	var out []string
+	for _, e := range d.Added {
+		out = append(out, "+ "+e.String())
+	}
+	for _, e := range d.Removed {
+		out = append(out, "- "+e.String())
+	}
+	for _, m := range d.Moved {
+		out = append(out, "~ "+m.From.String()+" -> "+m.To.String())
+	}
+	return strings.Join(out, "\n")
+}
+
+func (fields JSONStructFieldFullUsages) entries(root, owner, parentPath string, out map[string]StructFieldUsageEntry) {
+	for _, field := range fields {
+		path := field.Name
+		if field.Via != "" {
+			// The promoted field is identified by its full path through the embedded fields.
+			path = field.Via + "." + path
+		}
+		if field.Container != "" {
+			path += " [" + field.Container + "]"
+		}
+		if field.Variant != "" {
+			path += " [" + field.Variant + "]"
+		}
+		if parentPath != "" {
+			path = parentPath + "." + path
+		}
+		fieldOwner := owner
+		if field.Owner != "" {
+			fieldOwner = field.Owner
+		}
+		out[root+": "+path] = StructFieldUsageEntry{
+			Root:  root,
+			Path:  path,
+			Owner: fieldOwner,
+			Field: field.Name,
+		}
+
+		nestedOwner := field.Type
+		if field.Variant != "" {
+			nestedOwner = field.Variant
+		}
+		field.Fields.entries(root, nestedOwner, path, out)
+	}
+}
+
+// entries returns all the used fields, keyed by the string form of each entry. The instances of the same root
+// (i.e. in verbose mode) are merged.
+func (fus JSONStructFullUsages) entries() map[string]StructFieldUsageEntry {
+	out := map[string]StructFieldUsageEntry{}
+	for _, fu := range fus.Usages {
+		root := fu.Named
+		owner := fu.Named
+		if fu.Variant != "" {
+			root += " [" + fu.Variant + "]"
+			owner = fu.Variant
+		}
+		fu.Fields.entries(root, owner, "", out)
+	}
+	return out
+}
+
+// DiffStructFullUsages compares two StructFullUsages, in their JSON schema representation, and reports the fields
+// that become used, stop being used, or move between roots. The fields are compared by the identity of the types
+// and fields, rather than their textual output.
+func DiffStructFullUsages(oldFus, newFus JSONStructFullUsages) (StructFullUsagesDiff, error) {
+	if oldFus.Version != newFus.Version {
+		return StructFullUsagesDiff{}, fmt.Errorf("schema version mismatch: %d vs %d", oldFus.Version, newFus.Version)
+	}
+
+	oldEntries, newEntries := oldFus.entries(), newFus.entries()
+
+	// fieldID -> entries
+	added := map[string]StructFieldUsageEntries{}
+	removed := map[string]StructFieldUsageEntries{}
+	for k, e := range newEntries {
+		if _, ok := oldEntries[k]; !ok {
+			added[e.fieldID()] = append(added[e.fieldID()], e)
+		}
+	}
+	for k, e := range oldEntries {
+		if _, ok := newEntries[k]; !ok {
+			removed[e.fieldID()] = append(removed[e.fieldID()], e)
+		}
+	}
+
+	var d StructFullUsagesDiff
+	for id, removedEntries := range removed {
+		addedEntries := added[id]
+		sort.Sort(removedEntries)
+		sort.Sort(addedEntries)
+
+		// Pair the removed entries with the added entries of the same field as moves.
+		n := len(removedEntries)
+		if len(addedEntries) < n {
+			n = len(addedEntries)
+		}
+		for i := 0; i < n; i++ {
+			d.Moved = append(d.Moved, StructFieldUsageMove{
+				From: removedEntries[i],
+				To:   addedEntries[i],
+			})
+		}
+		d.Removed = append(d.Removed, removedEntries[n:]...)
+		added[id] = addedEntries[n:]
+	}
+	for _, addedEntries := range added {
+		d.Added = append(d.Added, addedEntries...)
+	}
+
+	sort.Sort(d.Added)
+	sort.Sort(d.Removed)
+	sort.Slice(d.Moved, func(i, j int) bool {
+		return d.Moved[i].From.String() < d.Moved[j].From.String()
+	})
+	return d, nil
+}
@@ -0,0 +1,62 @@
+package usedtype_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/magodo/usedtype/usedtype"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffStructFullUsages(t *testing.T) {
+	oldInput := `{
+  "version": 1,
+  "usages": [
+    {
+      "named": "sdk.ModelA",
+      "fields": [
+        {"name": "String", "json_tag": "string", "type": "string"},
+        {"name": "Property", "json_tag": "property", "type": "sdk.Property", "fields": [
+          {"name": "Int", "json_tag": "int", "type": "int"}
+        ]}
+      ]
+    }
+  ]
+}`
+	newInput := `{
+  "version": 1,
+  "usages": [
+    {
+      "named": "sdk.ModelA",
+      "fields": [
+        {"name": "Property", "json_tag": "property", "type": "sdk.Property"},
+        {"name": "ArrayOfString", "json_tag": "array_of_string", "type": "string"}
+      ]
+    },
+    {
+      "named": "sdk.Property",
+      "fields": [
+        {"name": "Int", "json_tag": "int", "type": "int"}
+      ]
+    }
+  ]
+}`
+
+	var oldFus, newFus usedtype.JSONStructFullUsages
+	require.NoError(t, json.Unmarshal([]byte(oldInput), &oldFus))
+	require.NoError(t, json.Unmarshal([]byte(newInput), &newFus))
+
+	d, err := usedtype.DiffStructFullUsages(oldFus, newFus)
+	require.NoError(t, err)
+	require.Equal(t, `+ sdk.ModelA: ArrayOfString
+- sdk.ModelA: String
+~ sdk.ModelA: Property.Int -> sdk.Property: Int`, d.String())
+
+	d, err = usedtype.DiffStructFullUsages(oldFus, oldFus)
+	require.NoError(t, err)
+	require.True(t, d.IsEmpty())
+
+	newFus.Version++
+	_, err = usedtype.DiffStructFullUsages(oldFus, newFus)
+	require.Error(t, err)
+}
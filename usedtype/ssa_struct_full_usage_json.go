@@ -0,0 +1,208 @@
+package usedtype
+
+import (
+	"encoding/json"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// StructFullUsagesJSONVersion is the version of the JSON schema of the StructFullUsages.
+// It should be increased whenever the schema is changed in a backward incompatible way.
+const StructFullUsagesJSONVersion = 1
+
+type JSONPosition struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+type JSONAccessPoint struct {
+	JSONPosition
+	Access string `json:"access"`
+
+	// CallStack is the positions of the call sites, from the outermost one, through which the access point is reached
+	// from the searched package. It is only set for the access points found by crossing the package boundary.
+	CallStack []JSONPosition `json:"call_stack,omitempty"`
+}
+
+type JSONStructFullUsages struct {
+	Version int                   `json:"version"`
+	Usages  []JSONStructFullUsage `json:"usages"`
+
+	// LoadReport is only set when the packages are loaded in best effort mode.
+	LoadReport *LoadReport `json:"load_report,omitempty"`
+
+	// Coverage is only set when the coverage summary is requested. Note that it is built from the struct trees (see
+	// BuildStructTrees), rather than the usages above.
+	Coverage *JSONStructCoverages `json:"coverage,omitempty"`
+}
+
+type JSONStructFullUsage struct {
+	Named   string `json:"named"`
+	Variant string `json:"variant,omitempty"`
+
+	// Alloc is only set in verbose mode (see StructFullRenderOption).
+	Alloc  *JSONPosition             `json:"alloc,omitempty"`
+	Fields JSONStructFieldFullUsages `json:"fields"`
+}
+
+type JSONStructFieldFullUsage struct {
+	Name    string `json:"name"`
+	JSONTag string `json:"json_tag,omitempty"`
+
+	// Type is the type of the field, with pointers, arrays and slices dereferenced. For a field that holds the nested
+	// structure through a container (see Container), it is the type of the nested structure.
+	Type    string `json:"type"`
+	Variant string `json:"variant,omitempty"`
+	// Container is the kind of the container (e.g. "map value"), through which the field holds the nested structure.
+	Container string `json:"container,omitempty"`
+	// Via is the dot separated names of the embedded fields, through which the field is promoted.
+	Via string `json:"via,omitempty"`
+	// Owner is the embedded structure that owns the promoted field. It is only set together with Via.
+	Owner string `json:"owner,omitempty"`
+
+	// AccessPoints is only set in verbose mode (see StructFullRenderOption).
+	AccessPoints []JSONAccessPoint         `json:"access_points,omitempty"`
+	Fields       JSONStructFieldFullUsages `json:"fields,omitempty"`
+}
+
+type JSONStructFieldFullUsages []JSONStructFieldFullUsage
+
+func newJSONPosition(pos token.Position) JSONPosition {
+	return JSONPosition{
+		Filename: pos.Filename,
+		Line:     pos.Line,
+		Column:   pos.Column,
+	}
+}
+
+func (key StructFieldFullUsageKey) toJSON() JSONStructFieldFullUsage {
+	typ := key.DereferenceRElem()
+	if key.elem != nil {
+		typ = key.elem
+	}
+	return JSONStructFieldFullUsage{
+		Name:      key.base.Field(key.index).Name(),
+		JSONTag:   key.JSONTag(),
+		Type:      typ.String(),
+		Variant:   namedTypeString(key.Variant),
+		Container: key.Container.String(),
+		Via:       key.Via,
+		Owner:     namedTypeString(key.owner),
+	}
+}
+
+func (nsf StructNestedFields) toJSON(opt *StructFullRenderOption) JSONStructFieldFullUsages {
+	keys := make(StructFieldFullUsageKeys, 0, len(nsf))
+	for k := range nsf {
+		keys = append(keys, k)
+	}
+	sort.Sort(keys)
+
+	out := make(JSONStructFieldFullUsages, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, nsf[k].ToJSON(opt))
+	}
+	return out
+}
+
+// ToJSON converts the StructFieldFullUsage to its JSON schema representation, the opt can be nil.
+func (ffu StructFieldFullUsage) ToJSON(opt *StructFullRenderOption) JSONStructFieldFullUsage {
+	out := ffu.Key.toJSON()
+	if opt.verbose() && len(ffu.VirtAccessPoints) != 0 {
+		vaps := make([]VirtAccessPoint, 0, len(ffu.VirtAccessPoints))
+		for vap := range ffu.VirtAccessPoints {
+			vaps = append(vaps, vap)
+		}
+		sort.Slice(vaps, func(i, j int) bool {
+			return vaps[i].Pos.String() < vaps[j].Pos.String()
+		})
+		for _, vap := range vaps {
+			ap := JSONAccessPoint{
+				JSONPosition: newJSONPosition(vap.Pos),
+				Access:       vap.Kind.String(),
+			}
+			for _, f := range vap.CallStack.Frames() {
+				ap.CallStack = append(ap.CallStack, newJSONPosition(f.Pos))
+			}
+			out.AccessPoints = append(out.AccessPoints, ap)
+		}
+	}
+	if len(ffu.NestedFields) != 0 {
+		out.Fields = ffu.NestedFields.toJSON(opt)
+	}
+	return out
+}
+
+// ToJSON converts the StructFullUsage to its JSON schema representation, the opt can be nil.
+func (fu StructFullUsage) ToJSON(opt *StructFullRenderOption) JSONStructFullUsage {
+	out := JSONStructFullUsage{
+		Named:   fu.Key.Named.String(),
+		Variant: namedTypeString(fu.Key.Variant),
+		Fields:  fu.NestedFields.toJSON(opt),
+	}
+	if opt.verbose() {
+		pos := newJSONPosition(fu.Alloc.Position)
+		out.Alloc = &pos
+	}
+	return out
+}
+
+// ToJSON converts the StructFullUsages to its JSON schema representation, the opt can be nil.
+// Similar to Render(), in non-verbose mode, all the instances of a struct full usage are flattened into one.
+func (fus StructFullUsages) ToJSON(opt *StructFullRenderOption) JSONStructFullUsages {
+	keys := make(StructFullUsageKeys, 0, len(fus.UsagesAmongAlloc))
+	for k := range fus.UsagesAmongAlloc {
+		keys = append(keys, k)
+	}
+	sort.Sort(keys)
+
+	out := JSONStructFullUsages{
+		Version: StructFullUsagesJSONVersion,
+		Usages:  []JSONStructFullUsage{},
+	}
+	for _, key := range keys {
+		usageAmongAlloc := fus.UsagesAmongAlloc[key]
+
+		if !opt.verbose() {
+			fu := usageAmongAlloc.Flatten()
+			if fu == nil {
+				continue
+			}
+			out.Usages = append(out.Usages, fu.ToJSON(opt))
+			continue
+		}
+
+		allocs := make(Allocs, 0, len(usageAmongAlloc))
+		for alloc := range usageAmongAlloc {
+			allocs = append(allocs, alloc)
+		}
+		sort.Sort(allocs)
+
+		for _, alloc := range allocs {
+			out.Usages = append(out.Usages, usageAmongAlloc[alloc].ToJSON(opt))
+		}
+	}
+	return out
+}
+
+func (ffu StructFieldFullUsage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ffu.ToJSON(nil))
+}
+
+func (fu StructFullUsage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fu.ToJSON(nil))
+}
+
+func (fus StructFullUsages) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fus.ToJSON(nil))
+}
+
+// namedTypeString returns the string of a named type, or an empty string if it is nil.
+func namedTypeString(nt *types.Named) string {
+	if nt == nil {
+		return ""
+	}
+	return nt.String()
+}
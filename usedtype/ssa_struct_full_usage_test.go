@@ -1,9 +1,13 @@
 package usedtype_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"go/types"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/magodo/usedtype/usedtype"
@@ -278,3 +282,653 @@ a/foo.Foo
 		require.Equal(t, c.expect, "\n"+fus.String()+"\n", idx)
 	}
 }
+
+func TestStructFullUsagesJSON(t *testing.T) {
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathCrossFunc, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+	fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet,
+		&usedtype.StructFullBuildOption{
+			Callgraph: graph,
+		},
+	)
+	b, err := json.MarshalIndent(fus, "", "  ")
+	require.NoError(t, err)
+	require.Equal(t, `{
+  "version": 1,
+  "usages": [
+    {
+      "named": "sdk.ModelA",
+      "fields": [
+        {
+          "name": "String",
+          "json_tag": "string",
+          "type": "string"
+        },
+        {
+          "name": "Property",
+          "json_tag": "property",
+          "type": "sdk.Property",
+          "fields": [
+            {
+              "name": "Int",
+              "json_tag": "int",
+              "type": "int"
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}`, string(b))
+}
+
+func TestBuildStructTreesUnused(t *testing.T) {
+	cases := []struct {
+		dir      string
+		patterns []string
+		epattern string
+		filter   usedtype.NamedTypeFilter
+		expect   string
+	}{
+		// 0
+		{
+			pathA,
+			[]string{"."},
+			"sdk",
+			filterTypeByName("sdk.ModelA"),
+			`
+sdk.ModelA
+    PropWrapper (prop_wrapper)
+        Prop (prop)
+            Int (int)
+    ArrOfPropWrapper (array_of_prop_wrapper)
+        Prop (prop)
+            Int (int)
+`,
+		},
+		// 1
+		{
+			pathInterfaceProperty,
+			[]string{"."},
+			"sdk",
+			filterTypeByName("sdk.AnimalFamily"),
+			`
+sdk.AnimalFamily [sdk.BirdFamily]
+    Animals (animals) [sdk.Bird]
+        Name (name)
+        FlySpeed (fly_speed)
+    Animals (animals) [sdk.Dog]
+        Name (name)
+        RunSpeed (run_speed)
+    Animals (animals) [sdk.Fish]
+        Name (name)
+        SwimSpeed (swim_speed)
+sdk.AnimalFamily [sdk.DogFamily]
+    Animals (animals) [sdk.Bird] (used)
+        Name (name)
+        FlySpeed (fly_speed)
+sdk.AnimalFamily [sdk.FishFamily]
+    Animals (animals) [sdk.Bird]
+        Name (name)
+        FlySpeed (fly_speed)
+    Animals (animals) [sdk.Dog]
+        Name (name)
+        RunSpeed (run_speed)
+    Animals (animals) [sdk.Fish]
+        Name (name)
+        SwimSpeed (swim_speed)
+`,
+		},
+	}
+
+	for idx, c := range cases {
+		pkgs, ssapkgs, _, err := usedtype.BuildPackages(c.dir, c.patterns, usedtype.CallGraphTypeNA)
+		require.NoError(t, err, idx)
+		directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+		targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile(c.epattern), c.filter)
+		trees := usedtype.BuildStructTrees(directUsage, targetRootSet, nil)
+		require.Equal(t, c.expect, "\n"+trees.Unused().String()+"\n", idx)
+	}
+}
+
+func TestBuildStructCoverages(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathA, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), nil)
+	coverages := usedtype.BuildStructCoverages(directUsage, targetRootSet, nil)
+	require.Equal(t, `sdk.ModelA: 8/10 (80.00%)
+sdk.Property: 1/1 (100.00%)
+Total: 9/11 (81.82%)`, coverages.String())
+}
+
+func TestStructCoveragesToJSON(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathA, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), nil)
+	coverages := usedtype.BuildStructCoverages(directUsage, targetRootSet, nil)
+	b, err := json.Marshal(coverages.ToJSON())
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+  "roots": {
+    "sdk.ModelA": {"total": 10, "used": 8, "percentage": 80},
+    "sdk.Property": {"total": 1, "used": 1, "percentage": 100}
+  },
+  "total": {"total": 11, "used": 9, "percentage": 81.81818181818183}
+}`, string(b))
+}
+
+func TestBuildStructFullUsagesValueFlow(t *testing.T) {
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathValueFlow, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+	fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet,
+		&usedtype.StructFullBuildOption{
+			Callgraph: graph,
+			ValueFlow: usedtype.NewValueFlowGraph(ssapkgs[0].Prog, graph),
+		},
+	)
+
+	// Each instance only has the fields that are used on itself.
+	require.Equal(t, []string{
+		`13: sdk.ModelA
+    PointerOfProperty (pointer_of_property)
+        Int (int)`,
+		`18: sdk.ModelA
+    String (string)
+    ArrayOfString (array_of_string)`,
+		`31: sdk.ModelA
+    String (string)`,
+		`8: sdk.ModelA
+    String (string)
+    Property (property)
+        Int (int)`,
+	}, usagesPerAlloc(t, fus))
+}
+
+func TestBuildStructFullUsagesValueFlowElem(t *testing.T) {
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathValueFlowElem, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+	fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet,
+		&usedtype.StructFullBuildOption{
+			Callgraph: graph,
+			ValueFlow: usedtype.NewValueFlowGraph(ssapkgs[0].Prog, graph),
+		},
+	)
+
+	// The elements of a container are shared by all its element accesses, including the ones via append and copy. The
+	// containers (e.g. the backing arrays) contain the usages of their elements.
+	require.Equal(t, []string{
+		`10: sdk.ModelA
+    String (string)`,
+		`14: sdk.ModelA
+    ArrayOfString (array_of_string)`,
+		`16: sdk.ModelA
+    ArrayOfString (array_of_string)`,
+		`20: sdk.ModelA
+    PointerOfProperty (pointer_of_property)`,
+		`21: sdk.ModelA
+    PointerOfProperty (pointer_of_property)`,
+		`22: sdk.ModelA
+    PointerOfProperty (pointer_of_property)`,
+		`26: sdk.ModelA
+    Property (property)`,
+		`32: sdk.ModelA`,
+		`40: sdk.ModelA
+    String (string)`,
+		`9: sdk.ModelA
+    String (string)`,
+	}, usagesPerAlloc(t, fus))
+}
+
+// usagesPerAlloc returns the struct full usage of each alloc of the only root type, prefixed by the line of the alloc.
+func usagesPerAlloc(t *testing.T, fus usedtype.StructFullUsages) []string {
+	require.Len(t, fus.UsagesAmongAlloc, 1)
+	var usageAmongAlloc usedtype.StructFullUsageAmongAlloc
+	for _, usageAmongAlloc = range fus.UsagesAmongAlloc {
+	}
+	allocs := make(usedtype.Allocs, 0, len(usageAmongAlloc))
+	for alloc := range usageAmongAlloc {
+		allocs = append(allocs, alloc)
+	}
+	sort.Sort(allocs)
+	var out []string
+	for _, alloc := range allocs {
+		out = append(out, fmt.Sprintf("%d: %s", alloc.Position.Line, usageAmongAlloc[alloc]))
+	}
+	return out
+}
+
+// accessPoints returns the virtual access points in the direct usage map, each in form of "<type>.<field>: <detail>"
+// where the detail is returned by the format function, sorted.
+func accessPoints(du usedtype.StructDirectUsageMap, format func(vap usedtype.VirtAccessPoint) string) []string {
+	var out []string
+	for nt, fields := range du {
+		for field, vaps := range fields {
+			for _, vap := range vaps {
+				out = append(out, fmt.Sprintf("%s.%s: %s", nt, field, format(vap)))
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestBuildStructFullUsagesReachability(t *testing.T) {
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathReachability, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+	fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet,
+		&usedtype.StructFullBuildOption{
+			Callgraph: graph,
+		},
+	)
+
+	// The call site of useString() is not reachable from the alloc, neither the other way around.
+	require.Equal(t, []string{
+		`10: sdk.ModelA
+    Property (property)`,
+	}, usagesPerAlloc(t, fus))
+}
+
+func TestBuildStructFullUsagesDominance(t *testing.T) {
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathDominance, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+
+	cases := []struct {
+		dominance bool
+		expect    []string
+	}{
+		{
+			// The call site of useArrayOfString() is reachable from the alloc.
+			dominance: false,
+			expect: []string{
+				`11: sdk.ModelA
+    Property (property)
+    ArrayOfString (array_of_string)`,
+			},
+		},
+		{
+			// The call site of useArrayOfString() is reachable from the alloc, but not on every path.
+			dominance: true,
+			expect: []string{
+				`11: sdk.ModelA
+    Property (property)`,
+			},
+		},
+	}
+
+	for idx, c := range cases {
+		fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet,
+			&usedtype.StructFullBuildOption{
+				Callgraph: graph,
+				Dominance: c.dominance,
+			},
+		)
+		require.Equal(t, c.expect, usagesPerAlloc(t, fus), idx)
+	}
+}
+
+func TestBuildStructFullUsagesProgress(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathCrossFunc, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), nil)
+
+	var dones []int
+	total := 0
+	fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet,
+		&usedtype.StructFullBuildOption{
+			Concurrency: 2,
+			Progress: func(done, n int, current *types.Named) {
+				dones = append(dones, done)
+				total = n
+			},
+		},
+	)
+
+	require.NotZero(t, total)
+	require.Equal(t, len(fus.UsagesAmongAlloc), total)
+	for i, done := range dones {
+		require.Equal(t, i+1, done)
+	}
+	require.Len(t, dones, total)
+}
+
+func TestStructFullUsagesRenderVerbose(t *testing.T) {
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathCrossFunc, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+
+	// Build and render with different settings concurrently.
+	var (
+		wg              sync.WaitGroup
+		verbose, simple string
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, &usedtype.StructFullBuildOption{
+			Callgraph:             graph,
+			RecordAllAccessPoints: true,
+		})
+		verbose = fus.Render(&usedtype.StructFullRenderOption{Verbose: true})
+	}()
+	go func() {
+		defer wg.Done()
+		fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, &usedtype.StructFullBuildOption{
+			Callgraph: graph,
+		})
+		simple = fus.Render(nil)
+	}()
+	wg.Wait()
+
+	require.Equal(t, strings.ReplaceAll(`sdk.ModelA
+%[1]s/main.go:8:21
+    String (string)
+      %[1]s/main.go:8:28
+    Property (property)
+      %[1]s/main.go:8:43`, "%[1]s", pathCrossFunc), verbose)
+	require.Equal(t, `sdk.ModelA
+    String (string)
+    Property (property)`, simple)
+}
+
+func TestSetStructFieldUsageVerbose(t *testing.T) {
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathCrossFunc, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("sdk"), filterTypeByName("sdk.ModelA"))
+
+	usedtype.SetStructFieldUsageVerbose(true)
+	defer usedtype.SetStructFieldUsageVerbose(false)
+
+	// The deprecated switch only applies to rendering without an option.
+	fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, &usedtype.StructFullBuildOption{Callgraph: graph})
+	require.Equal(t, strings.ReplaceAll(`sdk.ModelA
+%[1]s/main.go:8:21
+    String (string)
+      %[1]s/main.go:8:28
+    Property (property)
+      %[1]s/main.go:8:43`, "%[1]s", pathCrossFunc), fus.String())
+
+	// An explicit option takes precedence.
+	require.Equal(t, `sdk.ModelA
+    String (string)
+    Property (property)`, fus.Render(&usedtype.StructFullRenderOption{}))
+}
+
+func TestBuildStructFullUsagesCollapseEmbedded(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathEmbedded, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("a/model"), filterTypeByName("a/model.VirtualMachine"))
+
+	cases := []struct {
+		opt    *usedtype.StructFullBuildOption
+		usages string
+		unused string
+	}{
+		// 0
+		{
+			nil,
+			`
+a/model.VirtualMachine
+    Base
+        Resource
+            Name (name)
+        Location (location)
+    Size (size)
+`,
+			`
+a/model.VirtualMachine
+    Base (used)
+        Resource (used)
+            ID (id)
+`,
+		},
+		// 1
+		// The embedded Base is kept as it is assigned in the composite literal, while Resource is only accessed to
+		// select the promoted fields.
+		{
+			&usedtype.StructFullBuildOption{CollapseEmbedded: true},
+			`
+a/model.VirtualMachine
+    Base
+    Location (location) (via Base)
+    Name (name) (via Base.Resource)
+    Size (size)
+`,
+			`
+a/model.VirtualMachine
+    ID (id) (via Base.Resource)
+`,
+		},
+	}
+
+	for idx, c := range cases {
+		fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, c.opt)
+		require.Equal(t, c.usages, "\n"+fus.String()+"\n", idx)
+		trees := usedtype.BuildStructTrees(directUsage, targetRootSet, c.opt)
+		require.Equal(t, c.unused, "\n"+trees.Unused().String()+"\n", idx)
+		require.Equal(t, "a/model.VirtualMachine: 3/4 (75.00%)\nTotal: 3/4 (75.00%)", trees.Coverage().String(), idx)
+	}
+
+	// Only the direct accesses of the collapsed embedded field are kept.
+	fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, &usedtype.StructFullBuildOption{CollapseEmbedded: true, RecordAllAccessPoints: true})
+	require.Contains(t, fus.Render(&usedtype.StructFullRenderOption{Verbose: true}), strings.ReplaceAll(`
+    Base
+      %[1]s/main.go:8:33
+    Location (location) (via Base)
+`, "%[1]s", pathEmbedded))
+}
+
+func TestBuildStructFullUsagesIncludeUnexported(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathUnexported, []string{"./..."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("a/model"), nil)
+
+	cases := []struct {
+		include bool
+		usages  string
+		unused  string
+	}{
+		// 0
+		{
+			false,
+			`
+a/model.Model
+    Name (name)
+`,
+			"\n\n",
+		},
+		// 1
+		{
+			true,
+			`
+a/model.Model
+    Name (name)
+    state
+`,
+			`
+a/model.Model
+    deleted
+    created
+`,
+		},
+	}
+
+	for idx, c := range cases {
+		directUsage := usedtype.FindInPackageStructureDirectUsageWithOptions(pkgs, ssapkgs, &usedtype.StructDirectUsageOption{IncludeUnexported: c.include})
+		opt := &usedtype.StructFullBuildOption{IncludeUnexported: c.include}
+		fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, opt)
+		require.Equal(t, c.usages, "\n"+fus.String()+"\n", idx)
+		trees := usedtype.BuildStructTrees(directUsage, targetRootSet, opt)
+		require.Equal(t, c.unused, "\n"+trees.Unused().String()+"\n", idx)
+	}
+}
+
+func TestBuildStructFullUsagesContainer(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathContainer, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	directUsage := usedtype.FindInPackageStructureDirectUsage(pkgs, ssapkgs)
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("a/model"), filterTypeByName("a/model.Resource"))
+
+	cases := []struct {
+		opt    *usedtype.StructFullBuildOption
+		usages string
+		unused string
+	}{
+		// 0
+		{
+			nil,
+			`
+a/model.Resource
+    Tags (tags) [map value]
+        Key (key)
+        Value (value)
+    Lookup (lookup) [map key]
+        ID (id)
+    Lookup (lookup) [map value]
+        Key (key)
+        Value (value)
+    Events [chan]
+        Name (name)
+    NewBuilder
+`,
+			`
+a/model.Resource
+    Lookup (lookup) [map key] (used)
+        Scope (scope)
+    Events [chan] (used)
+        Time (time)
+`,
+		},
+		// 1
+		{
+			&usedtype.StructFullBuildOption{FollowFuncResults: true},
+			`
+a/model.Resource
+    Tags (tags) [map value]
+        Key (key)
+        Value (value)
+    Lookup (lookup) [map key]
+        ID (id)
+    Lookup (lookup) [map value]
+        Key (key)
+        Value (value)
+    Events [chan]
+        Name (name)
+    NewBuilder [func result]
+        Size (size)
+`,
+			`
+a/model.Resource
+    Lookup (lookup) [map key] (used)
+        Scope (scope)
+    Events [chan] (used)
+        Time (time)
+    NewBuilder [func result] (used)
+        Count (count)
+`,
+		},
+	}
+
+	for idx, c := range cases {
+		fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, c.opt)
+		require.Equal(t, c.usages, "\n"+fus.String()+"\n", idx)
+		trees := usedtype.BuildStructTrees(directUsage, targetRootSet, c.opt)
+		require.Equal(t, c.unused, "\n"+trees.Unused().String()+"\n", idx)
+	}
+}
+
+func TestBuildStructFullUsagesGeneric(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathGeneric, []string{"./..."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+
+	cases := []struct {
+		mode   usedtype.GenericMode
+		usages string
+	}{
+		// 0
+		{
+			usedtype.GenericModeInstance,
+			`
+a/model.Page[T]
+    Items (items)
+    Count (count)
+a/model.Page[a/model.Disk]
+    Count (count)
+a/model.Page[a/model.VirtualMachine]
+    Items (items)
+        Name (name)
+    NextLink (nextLink)
+a/model.VirtualMachine
+    Name (name)
+`,
+		},
+		// 1
+		{
+			usedtype.GenericModeOrigin,
+			`
+a/model.Page[T any]
+    Items (items)
+    NextLink (nextLink)
+    Count (count)
+a/model.VirtualMachine
+    Name (name)
+`,
+		},
+	}
+
+	for idx, c := range cases {
+		gctx := usedtype.NewGenericContext()
+		directUsage := usedtype.FindInPackageStructureDirectUsageWithOptions(pkgs, ssapkgs, &usedtype.StructDirectUsageOption{Generic: c.mode, GenericContext: gctx})
+		targetRootSet := usedtype.FindNamedTypeAllocSetInPackageWithOptions(pkgs, ssapkgs, regexp.MustCompile("a/model"), nil, &usedtype.NamedTypeAllocSetOption{Generic: c.mode, GenericContext: gctx})
+		fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, &usedtype.StructFullBuildOption{Generic: c.mode, GenericContext: gctx})
+		require.Equal(t, c.usages, "\n"+fus.String()+"\n", idx)
+	}
+}
+
+func TestBuildStructFullUsagesImplicit(t *testing.T) {
+	pkgs, ssapkgs, graph, err := usedtype.BuildPackages(pathImplicitFlow, []string{"."}, usedtype.CallGraphTypeStatic)
+	require.NoError(t, err)
+	model := &usedtype.ImplicitUsageModel{
+		Funcs: []usedtype.ImplicitUsageFunc{{Pkg: "a/codec", Name: "Decode", Arg: 1, Tag: "json"}},
+	}
+	directUsage := usedtype.FindInPackageStructureDirectUsageWithOptions(pkgs, ssapkgs, &usedtype.StructDirectUsageOption{ImplicitUsage: model})
+	targetRootSet := usedtype.FindNamedTypeAllocSetInPackage(pkgs, ssapkgs, regexp.MustCompile("a/model"), filterTypeByName("a/model.Config"))
+	pts, err := usedtype.AnalyzePointsTo(ssapkgs[0].Prog, targetRootSet, directUsage)
+	require.NoError(t, err)
+	require.Empty(t, pts.UnresolvedRoots)
+	require.Empty(t, pts.UnresolvedAccessPoints)
+
+	// The implicit usages are only linked to the instance passed to the decoder.
+	expect := []string{
+		`12: a/model.Config
+    Name (name)`,
+		`9: a/model.Config
+    Name (name)
+    Nested (nested)
+        Enabled (enabled)
+    Tags (tags) [map value]
+        Value (value)`,
+	}
+	for idx, opt := range []*usedtype.StructFullBuildOption{
+		{Callgraph: graph, ValueFlow: usedtype.NewValueFlowGraph(ssapkgs[0].Prog, graph)},
+		{Callgraph: graph, PointsTo: pts},
+	} {
+		fus := usedtype.BuildStructFullUsages(directUsage, targetRootSet, opt)
+		require.Equal(t, expect, usagesPerAlloc(t, fus), idx)
+	}
+}
@@ -0,0 +1,332 @@
+package usedtype
+
+import (
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// StructFieldTree is a node in the full type tree of a Named structure, regardless of whether the field is used or not.
+type StructFieldTree struct {
+	Key StructFieldFullUsageKey
+
+	// Used indicates whether the field is directly used, i.e. it appears in the StructDirectUsageMap.
+	Used         bool
+	NestedFields StructNestedFieldTrees
+}
+
+type StructNestedFieldTrees map[StructFieldFullUsageKey]StructFieldTree
+
+// StructTree is the full type tree of a Named structure, or a variant of a Named interface.
+type StructTree struct {
+	Key          StructFullUsageKey
+	NestedFields StructNestedFieldTrees
+}
+
+type StructTrees map[StructFullUsageKey]StructTree
+
+// structTreeBuilder builds the full type trees, it records the known implementors of each interface.
+type structTreeBuilder struct {
+	dm           StructDirectUsageMap
+	opt          *StructFullBuildOption
+	implementors map[*types.Named][]*types.Named
+
+	// rootPkg is the package that defines the root type being built. The unexported fields are only included for the
+	// structures defined in it, if required.
+	rootPkg *types.Package
+}
+
+// includes checks whether the field of the structure is included in the tree.
+func (b *structTreeBuilder) includes(baseStruct *types.Named, field StructField) bool {
+	if field.Exported() {
+		return true
+	}
+	return b.opt != nil && b.opt.IncludeUnexported && b.rootPkg != nil && baseStruct.Obj().Pkg() == b.rootPkg
+}
+
+func (b *structTreeBuilder) implements(v, itf *types.Named) bool {
+	if b.opt != nil && b.opt.CustomImplements != nil {
+		return b.opt.CustomImplements(v, itf)
+	}
+	return types.Implements(v, itf.Underlying().(*types.Interface))
+}
+
+// implementorsOf returns the Named structures that implement the Named interface "itf". The candidates are the
+// Named structures defined in the same package as "itf", together with the ones appear in the direct usage map.
+func (b *structTreeBuilder) implementorsOf(itf *types.Named) []*types.Named {
+	if impls, ok := b.implementors[itf]; ok {
+		return impls
+	}
+
+	candidates := map[*types.Named]struct{}{}
+	for nt := range b.dm {
+		candidates[nt] = struct{}{}
+	}
+	if pkg := itf.Obj().Pkg(); pkg != nil {
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok {
+				continue
+			}
+			if nt, ok := tn.Type().(*types.Named); ok {
+				candidates[nt] = struct{}{}
+			}
+		}
+	}
+
+	var impls namedTypes
+	for nt := range candidates {
+		if _, ok := nt.Underlying().(*types.Struct); !ok {
+			continue
+		}
+		// Whether an uninstantiated generic type implements an interface is unspecified.
+		if nt.TypeParams().Len() != 0 {
+			continue
+		}
+		if !b.implements(nt, itf) {
+			continue
+		}
+		impls = append(impls, nt)
+	}
+	sort.Sort(impls)
+	b.implementors[itf] = impls
+	return impls
+}
+
+// build builds the nested field trees for a given Named structure (baseStruct).
+func (nft StructNestedFieldTrees) build(b *structTreeBuilder, baseStruct *types.Named, seenStructures map[*types.Named]struct{}) {
+	if _, ok := seenStructures[baseStruct]; ok {
+		return
+	}
+	seenStructures[baseStruct] = struct{}{}
+
+	st := baseStruct.Underlying().(*types.Struct)
+	du := b.dm[baseStruct]
+
+	for i := 0; i < st.NumFields(); i++ {
+		nestedField := StructField{
+			base:  st,
+			index: i,
+		}
+		if !b.includes(baseStruct, nestedField) {
+			continue
+		}
+		_, used := du[nestedField]
+		elems := namedElemTypes(nestedField.base.Field(nestedField.index).Type(), b.opt.followFuncResults())
+		if len(elems) == 0 {
+			k := StructFieldFullUsageKey{
+				StructField: nestedField,
+			}
+			nft[k] = StructFieldTree{
+				Key:          k,
+				Used:         used,
+				NestedFields: StructNestedFieldTrees{},
+			}
+			continue
+		}
+
+		for _, elem := range elems {
+			nt := canonicalNamed(elem.Type.(*types.Named), b.opt.genericMode(), b.opt.genericContext())
+			var elemNamed *types.Named
+			if elem.Kind != ContainerKindNone {
+				elemNamed = nt
+			}
+			switch nt.Underlying().(type) {
+			case *types.Interface:
+				impls := b.implementorsOf(nt)
+				if len(impls) == 0 {
+					k := StructFieldFullUsageKey{
+						StructField: nestedField,
+						Container:   elem.Kind,
+						elem:        elemNamed,
+					}
+					nft[k] = StructFieldTree{
+						Key:          k,
+						Used:         used,
+						NestedFields: StructNestedFieldTrees{},
+					}
+					continue
+				}
+				for _, impl := range impls {
+					k := StructFieldFullUsageKey{
+						StructField: nestedField,
+						Variant:     impl,
+						Container:   elem.Kind,
+						elem:        elemNamed,
+					}
+					tree := StructFieldTree{
+						Key:          k,
+						Used:         used,
+						NestedFields: StructNestedFieldTrees{},
+					}
+					tree.NestedFields.build(b, impl, copySeenStructures(seenStructures))
+					nft[k] = tree
+				}
+			case *types.Struct:
+				k := StructFieldFullUsageKey{
+					StructField: nestedField,
+					Container:   elem.Kind,
+					elem:        elemNamed,
+				}
+				tree := StructFieldTree{
+					Key:          k,
+					Used:         used,
+					NestedFields: StructNestedFieldTrees{},
+				}
+				tree.NestedFields.build(b, nt, copySeenStructures(seenStructures))
+				// Collapse the fields of the embedded structure into the current one, as the promoted fields. A promoted
+				// field is used only if the embedded field is used.
+				if b.opt != nil && b.opt.CollapseEmbedded && nestedField.Embedded() && len(tree.NestedFields) != 0 {
+					for k, nested := range tree.NestedFields {
+						nested.Key = k.promote(nestedField)
+						nested.Used = nested.Used && used
+						nft[nested.Key] = nested
+					}
+					continue
+				}
+				nft[k] = tree
+			default:
+				panic("will never happen")
+			}
+		}
+	}
+}
+
+func copySeenStructures(seenStructures map[*types.Named]struct{}) map[*types.Named]struct{} {
+	out := make(map[*types.Named]struct{}, len(seenStructures))
+	for k, v := range seenStructures {
+		out[k] = v
+	}
+	return out
+}
+
+// BuildStructTrees builds the full type tree for each type in rootSet, as long as the type is a structure or interface
+// that is implemented by some structures. Different from BuildStructFullUsages, it extends all the exported fields
+// no matter they are used or not, while recording whether each field appears in "dm".
+//
+// Note that a field is regarded as used as long as it appears in "dm", i.e. the call graph, value flow and points-to
+// analysis in "opt", which narrow down the usages of each root in BuildStructFullUsages, are not taken into account.
+// So the unused fields and the coverage are based on all the direct usages of each structure.
+func BuildStructTrees(dm StructDirectUsageMap, rootSet NamedTypeAllocSet, opt *StructFullBuildOption) StructTrees {
+	b := &structTreeBuilder{
+		dm:           dm,
+		opt:          opt,
+		implementors: map[*types.Named][]*types.Named{},
+	}
+
+	trees := StructTrees{}
+	for root := range rootSet {
+		b.rootPkg = root.Obj().Pkg()
+		var variants []*types.Named
+		switch root.Underlying().(type) {
+		case *types.Interface:
+			variants = b.implementorsOf(root)
+		case *types.Struct:
+			variants = []*types.Named{nil}
+		default:
+			continue
+		}
+
+		for _, variant := range variants {
+			k := StructFullUsageKey{
+				Named:   root,
+				Variant: variant,
+			}
+			base := root
+			if variant != nil {
+				base = variant
+			}
+			tree := StructTree{
+				Key:          k,
+				NestedFields: StructNestedFieldTrees{},
+			}
+			tree.NestedFields.build(b, base, map[*types.Named]struct{}{})
+			trees[k] = tree
+		}
+	}
+	return trees
+}
+
+// unused returns the nested field trees that only contains the unused fields, and the used fields that have
+// unused nested fields. Once a field is unused, all its nested fields are regarded as unused.
+func (nft StructNestedFieldTrees) unused(parentUsed bool) StructNestedFieldTrees {
+	out := StructNestedFieldTrees{}
+	for k, tree := range nft {
+		used := parentUsed && tree.Used
+		nested := tree.NestedFields.unused(used)
+		if used && len(nested) == 0 {
+			continue
+		}
+		out[k] = StructFieldTree{
+			Key:          k,
+			Used:         used,
+			NestedFields: nested,
+		}
+	}
+	return out
+}
+
+// Unused returns the struct trees that only contain the unused fields. The used fields are kept only if they have
+// unused nested fields. The struct trees that have no unused field are omitted.
+func (trees StructTrees) Unused() StructTrees {
+	out := StructTrees{}
+	for k, tree := range trees {
+		nested := tree.NestedFields.unused(true)
+		if len(nested) == 0 {
+			continue
+		}
+		out[k] = StructTree{
+			Key:          k,
+			NestedFields: nested,
+		}
+	}
+	return out
+}
+
+func (nft StructNestedFieldTrees) stringWithIndent(ident int) []string {
+	var keys StructFieldFullUsageKeys = make([]StructFieldFullUsageKey, 0, len(nft))
+	for k := range nft {
+		keys = append(keys, k)
+	}
+	sort.Sort(keys)
+
+	var out []string
+	for _, key := range keys {
+		out = append(out, nft[key].stringWithIndent(ident))
+	}
+	return out
+}
+
+func (tree StructFieldTree) String() string {
+	return tree.stringWithIndent(0)
+}
+
+func (tree StructFieldTree) stringWithIndent(ident int) string {
+	prefix := strings.Repeat("  ", ident)
+	line := prefix + tree.Key.String()
+	if tree.Used {
+		line += " (used)"
+	}
+	out := append([]string{line}, tree.NestedFields.stringWithIndent(ident+2)...)
+	return strings.Join(out, "\n")
+}
+
+func (tree StructTree) String() string {
+	out := append([]string{tree.Key.String()}, tree.NestedFields.stringWithIndent(2)...)
+	return strings.Join(out, "\n")
+}
+
+func (trees StructTrees) String() string {
+	keys := make(StructFullUsageKeys, 0, len(trees))
+	for k := range trees {
+		keys = append(keys, k)
+	}
+	sort.Sort(keys)
+
+	var out []string
+	for _, key := range keys {
+		out = append(out, trees[key].String())
+	}
+	return strings.Join(out, "\n")
+}
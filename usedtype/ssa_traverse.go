@@ -2,52 +2,101 @@ package usedtype
 
 import (
 	"fmt"
+	"go/token"
 	"go/types"
+	"regexp"
 
 	"golang.org/x/tools/go/ssa"
 )
 
 type Traversal struct {
 	seen seen
+
+	// If non-nil, the traversal follows the calls into the functions defined in the other packages, whose import path
+	// matches it, and keeps the call stack.
+	crossPackage *regexp.Regexp
+	fset         *token.FileSet
+	stack        *CallStack
+	frames       callFrames
 }
 
+// seen records the functions, instructions and values that have been walked through, per call stack. So that in a
+// cross package traversal, a function called from different call sites is walked once for each of the call stacks.
+// As the call stacks are interned (see callFrames), the equal call stacks are keyed the same.
 type seen struct {
-	functions    map[*ssa.Function]struct{}
-	instructions map[ssa.Instruction]struct{}
-	values       map[ssa.Value]struct{}
+	functions    map[seenFunction]struct{}
+	instructions map[seenInstruction]struct{}
+	values       map[seenValue]struct{}
+}
+
+type seenFunction struct {
+	fn    *ssa.Function
+	stack *CallStack
+}
+
+type seenInstruction struct {
+	instr ssa.Instruction
+	stack *CallStack
+}
+
+type seenValue struct {
+	v     ssa.Value
+	stack *CallStack
+}
+
+func newSeen() seen {
+	return seen{
+		functions:    map[seenFunction]struct{}{},
+		instructions: map[seenInstruction]struct{}{},
+		values:       map[seenValue]struct{}{},
+	}
 }
 
+// maxCallStackDepth is the maximum depth of the call stack that a cross package traversal follows the calls to.
+const maxCallStackDepth = 8
+
 func NewTraversal() Traversal {
 	return Traversal{
-		seen: seen{
-			functions:    map[*ssa.Function]struct{}{},
-			instructions: map[ssa.Instruction]struct{}{},
-			values:       map[ssa.Value]struct{}{},
-		},
+		seen: newSeen(),
 	}
 }
 
+// NewCrossPackageTraversal returns a Traversal that, besides the functions in the walked package, follows the calls
+// into the functions defined in the other packages whose import path matches the "p" (pattern). The call stack from
+// the walked package to the current instruction is available via CallStack() in the callbacks.
+func NewCrossPackageTraversal(fset *token.FileSet, p *regexp.Regexp) Traversal {
+	t := NewTraversal()
+	t.crossPackage = p
+	t.fset = fset
+	t.frames = callFrames{}
+	return t
+}
+
+// CallStack returns the call stack of the instruction or value being visited, which is only non-nil for the ones in
+// the functions reached by following the calls in a cross package traversal.
+func (t *Traversal) CallStack() *CallStack {
+	return t.stack
+}
+
 type WalkInstrCallback func(instr ssa.Instruction)
 type WalkValueCallback func(val ssa.Value)
 
 // WalkInPackage traverse inside a usedtype package from all top level functions (skipping other top level members:
 // Type, NamedConst and Global). It will iterate each instruction and the value belongs to it.
-// Note that only the functions defined in this usedtype package is traversed, it will not cross package boundary.
+// Note that only the functions defined in this usedtype package is traversed, it will not cross package boundary,
+// unless it is a cross package traversal (see NewCrossPackageTraversal).
 func (t *Traversal) WalkInPackage(pkg *ssa.Package, icb WalkInstrCallback, vcb WalkValueCallback) {
-	t.seen = seen{
-		functions:    map[*ssa.Function]struct{}{},
-		instructions: map[ssa.Instruction]struct{}{},
-		values:       map[ssa.Value]struct{}{},
-	}
+	t.seen = newSeen()
 	for _, m := range pkg.Members {
 		switch m := m.(type) {
 		case *ssa.NamedConst,
 			*ssa.Type:
 		case *ssa.Global:
-			if _, ok := t.seen.values[m]; ok {
+			k := seenValue{v: m, stack: t.stack}
+			if _, ok := t.seen.values[k]; ok {
 				continue
 			}
-			t.seen.values[m] = struct{}{}
+			t.seen.values[k] = struct{}{}
 			if vcb != nil {
 				vcb(m)
 			}
@@ -60,36 +109,45 @@ func (t *Traversal) WalkInPackage(pkg *ssa.Package, icb WalkInstrCallback, vcb W
 
 	// Since the methods of package-level types do not belong to the package "member", which means above member-wise iteration
 	// will not cover those methods. We'll handle them below.
-	for _, typ := range pkg.Prog.RuntimeTypes() {
-		// Only handle package leve types that are named struct
-		if !IsUnderlyingNamedStruct(typ) {
+	for _, m := range pkg.Members {
+		typ, ok := m.(*ssa.Type)
+		if !ok {
 			continue
 		}
-		nt, _ := DereferenceR(typ).(*types.Named)
-
-		// Only handle the current package types
-		if nt.Obj().Pkg() != pkg.Pkg {
+		// Only handle package leve types that are named struct
+		if !IsUnderlyingNamedStruct(typ.Type()) {
 			continue
 		}
+		nt := typ.Type().(*types.Named)
 
-		mset := pkg.Prog.MethodSets.MethodSet(typ)
-		for i, n := 0, mset.Len(); i < n; i++ {
-			t.walkFunction(pkg, pkg.Prog.MethodValue(mset.At(i)), icb, vcb)
+		// Walk the declared methods (of both value and pointer receivers), including those of the generic types, whose
+		// functions are built with the type parameters.
+		for i, n := 0, nt.NumMethods(); i < n; i++ {
+			if fn := pkg.Prog.FuncValue(nt.Method(i)); fn != nil {
+				t.walkFunction(pkg, fn, icb, vcb)
+			}
 		}
 	}
 }
 
 func (t *Traversal) walkFunction(pkg *ssa.Package, fn *ssa.Function, icb WalkInstrCallback, vcb WalkValueCallback) {
-	// We only walk through the functions defined in current package boundary.
-	if fn.Package() != nil && fn.Package() != pkg {
+	// We only walk through the functions defined in current package boundary, unless crossing to the other packages
+	// via a call.
+	if fn.Package() != nil && fn.Package() != pkg && !t.canCross(fn) {
+		return
+	}
+
+	// Follow the calls from the other packages to a limited depth, and not into the recursive calls.
+	if t.stack != nil && (t.stack.depth() > maxCallStackDepth || t.stack.calls(fn)) {
 		return
 	}
 
-	// Record those functions have been traversed, to avoid cyclic call.
-	if _, ok := t.seen.functions[fn]; ok {
+	// Record those functions have been traversed (under the current call stack), to avoid cyclic call.
+	k := seenFunction{fn: fn, stack: t.stack}
+	if _, ok := t.seen.functions[k]; ok {
 		return
 	}
-	t.seen.functions[fn] = struct{}{}
+	t.seen.functions[k] = struct{}{}
 
 	for _, param := range fn.Params {
 		t.walkValue(pkg, param, icb, vcb)
@@ -106,10 +164,11 @@ func (t *Traversal) walkFunction(pkg *ssa.Package, fn *ssa.Function, icb WalkIns
 func (t *Traversal) walkInstructions(pkg *ssa.Package, fn *ssa.Function, icb WalkInstrCallback, vcb WalkValueCallback) {
 	for _, b := range fn.Blocks {
 		for _, instr := range b.Instrs {
-			if _, ok := t.seen.instructions[instr]; ok {
+			k := seenInstruction{instr: instr, stack: t.stack}
+			if _, ok := t.seen.instructions[k]; ok {
 				continue
 			}
-			t.seen.instructions[instr] = struct{}{}
+			t.seen.instructions[k] = struct{}{}
 
 			if icb != nil {
 				icb(instr)
@@ -118,22 +177,47 @@ func (t *Traversal) walkInstructions(pkg *ssa.Package, fn *ssa.Function, icb Wal
 			// traverse the operands in instructions
 			ops := instr.Operands(nil)
 
+			stack := t.stack
+			if site, ok := instr.(ssa.CallInstruction); ok && t.keepsCallStack(pkg, site) {
+				t.stack = t.frames.push(t.fset, t.stack, site)
+			}
 			for _, arg := range ops {
 				t.walkValue(pkg, *arg, icb, vcb)
 			}
+			t.stack = stack
 		}
 	}
 }
 
+// keepsCallStack checks whether to push the call site to the call stack, which is the case when the call crosses into
+// another package, or it is already in the callee of such a call.
+func (t *Traversal) keepsCallStack(pkg *ssa.Package, site ssa.CallInstruction) bool {
+	if t.crossPackage == nil {
+		return false
+	}
+	if t.stack != nil {
+		return true
+	}
+	callee := site.Common().StaticCallee()
+	return callee != nil && callee.Package() != nil && callee.Package() != pkg && t.crossPackage.MatchString(callee.Package().Pkg.Path())
+}
+
+// canCross checks whether the traversal can cross into the function defined in another package, via the current
+// call site.
+func (t *Traversal) canCross(fn *ssa.Function) bool {
+	return t.crossPackage != nil && t.stack != nil && t.crossPackage.MatchString(fn.Package().Pkg.Path())
+}
+
 func (t *Traversal) walkValue(pkg *ssa.Package, v ssa.Value, icb WalkInstrCallback, vcb WalkValueCallback) {
 	if v == nil {
 		return
 	}
 
-	if _, ok := t.seen.values[v]; ok {
+	k := seenValue{v: v, stack: t.stack}
+	if _, ok := t.seen.values[k]; ok {
 		return
 	}
-	t.seen.values[v] = struct{}{}
+	t.seen.values[k] = struct{}{}
 
 	phi, ok := v.(*ssa.Phi)
 	if !ok {
@@ -1,6 +1,7 @@
 package usedtype
 
 import (
+	"go/ast"
 	"go/token"
 
 	"golang.org/x/tools/go/ssa"
@@ -26,50 +27,175 @@ func BBCanReach(start, end *ssa.BasicBlock) bool {
 	return search(start)
 }
 
+// InstrPosition returns the user facing source position of the instruction. In case the position can't be resolved,
+// it returns an invalid (zero) position, which is printed as "-".
 func InstrPosition(fset *token.FileSet, instr ssa.Instruction) token.Position {
-	pos := instr.Pos()
-	if pos != token.NoPos {
-		return fset.Position(pos)
+	pos, _ := LookupInstrPosition(fset, instr)
+	return pos
+}
+
+// LookupInstrPosition is like InstrPosition, but it also reports whether the position is resolved.
+func LookupInstrPosition(fset *token.FileSet, instr ssa.Instruction) (token.Position, bool) {
+	pos := instrPos(instr)
+	if !pos.IsValid() {
+		return token.Position{}, false
 	}
+	return fset.Position(pos), true
+}
 
-	switch instr := instr.(type) {
-	case *ssa.FieldAddr:
-		// In case of composite literal, the the user facing position should be the one that assigns the field.
-		referrers := instr.Referrers()
-		if referrers != nil {
+// maxReferrerDepth is the maximum depth to walk up through the referrers when resolving the position of an instruction.
+const maxReferrerDepth = 3
+
+// instrPos returns the user facing source position of the instruction, or token.NoPos if it can't be resolved.
+// It tries the following in order:
+// - The position of the instruction itself, or a better one for some known instructions (e.g. composite literal)
+// - The position of the referrers of the instruction (recursively, up to maxReferrerDepth)
+// - The position of the enclosing function (recursively to the outermost function)
+func instrPos(instr ssa.Instruction) token.Pos {
+	if pos := knownInstrPos(instr); pos.IsValid() {
+		return pos
+	}
+
+	seen := map[ssa.Instruction]bool{instr: true}
+	current := []ssa.Instruction{instr}
+	for depth := 0; depth < maxReferrerDepth && len(current) != 0; depth++ {
+		var next []ssa.Instruction
+		for _, instr := range current {
+			v, ok := instr.(ssa.Value)
+			if !ok {
+				continue
+			}
+			referrers := v.Referrers()
+			if referrers == nil {
+				continue
+			}
 			for _, ref := range *referrers {
-				store, ok := ref.(*ssa.Store)
-				if !ok {
+				if seen[ref] {
 					continue
 				}
-				if store.Addr != instr {
-					continue
+				seen[ref] = true
+				if pos := knownInstrPos(ref); pos.IsValid() {
+					return pos
 				}
-				return fset.Position(store.Pos())
+				next = append(next, ref)
 			}
 		}
-		// fallback to the field owner's position, which is always available
-		return fset.Position(instr.X.Pos())
+		current = next
+	}
+
+	// Instructions that are not (or no longer) part of any basic block have no enclosing function.
+	if instr.Block() == nil {
+		return token.NoPos
+	}
+	for fn := instr.Parent(); fn != nil; fn = fn.Parent() {
+		if pos := fn.Pos(); pos.IsValid() {
+			return pos
+		}
+		if syntax := fn.Syntax(); syntax != nil && syntax.Pos().IsValid() {
+			return syntax.Pos()
+		}
+	}
+	return token.NoPos
+}
+
+// knownInstrPos returns the position of the instruction itself, or a better one for some known instructions.
+func knownInstrPos(instr ssa.Instruction) token.Pos {
+	pos := instr.Pos()
+	if pos.IsValid() {
+		return pos
+	}
+
+	switch instr := instr.(type) {
+	case *ssa.FieldAddr:
+		// In case of composite literal, the the user facing position should be the one that assigns the field.
+		if pos := storePos(instr); pos.IsValid() {
+			return pos
+		}
+		// fallback to the field owner's position
+		return instr.X.Pos()
 	case *ssa.MakeInterface:
-		return fset.Position(instr.X.Pos())
+		if pos := instr.X.Pos(); pos.IsValid() {
+			return pos
+		}
+		// In case of the zero value composite literal, which is built as a constant without position.
+		if _, ok := instr.X.(*ssa.Const); ok {
+			return zeroCompositeLitPos(instr)
+		}
+		return token.NoPos
 	case *ssa.Field:
 		// In case of composite literal, the the user facing position should be the one that assigns the field.
-		referrers := instr.Referrers()
-		if referrers != nil {
-			for _, ref := range *referrers {
-				store, ok := ref.(*ssa.Store)
-				if !ok {
-					continue
-				}
-				if store.Addr != instr {
-					continue
-				}
-				return fset.Position(store.Pos())
-			}
+		if pos := storePos(instr); pos.IsValid() {
+			return pos
 		}
-		// fallback to the field owner's position, which is always available
-		return fset.Position(instr.X.Pos())
+		// fallback to the field owner's position
+		return instr.X.Pos()
+	case *ssa.Extract:
+		return instr.Tuple.Pos()
 	default:
-		panic("We should extend if panic")
+		return token.NoPos
+	}
+}
+
+// storePos returns the position of the Store instruction that stores to the address v.
+func storePos(v ssa.Value) token.Pos {
+	referrers := v.Referrers()
+	if referrers == nil {
+		return token.NoPos
+	}
+	for _, ref := range *referrers {
+		store, ok := ref.(*ssa.Store)
+		if !ok {
+			continue
+		}
+		if store.Addr != v {
+			continue
+		}
+		return store.Pos()
 	}
+	return token.NoPos
+}
+
+// zeroCompositeLitPos returns the position of the zero value composite literal (e.g. "Foo{}") that the operand of the
+// instruction is built from, as the SSA builder turns it into a constant without position. As the instructions are
+// emitted in the source order, it is the first one in the enclosing function (excluding the nested function literals)
+// between the previous and the next instructions with position in the same block.
+func zeroCompositeLitPos(instr ssa.Instruction) token.Pos {
+	fn, b := instr.Parent(), instr.Block()
+	if fn == nil || b == nil || fn.Syntax() == nil {
+		return token.NoPos
+	}
+	from, to := fn.Syntax().Pos(), fn.Syntax().End()
+	before := true
+	for _, other := range b.Instrs {
+		if other == instr {
+			before = false
+			continue
+		}
+		pos := other.Pos()
+		if !pos.IsValid() {
+			continue
+		}
+		if before {
+			from = pos
+		} else {
+			to = pos
+			break
+		}
+	}
+
+	found := token.NoPos
+	ast.Inspect(fn.Syntax(), func(n ast.Node) bool {
+		if found.IsValid() || n == nil {
+			return false
+		}
+		if _, ok := n.(*ast.FuncLit); ok && n != fn.Syntax() {
+			return false
+		}
+		if lit, ok := n.(*ast.CompositeLit); ok && len(lit.Elts) == 0 && lit.Pos() > from && lit.Pos() < to {
+			found = lit.Lbrace
+			return false
+		}
+		return true
+	})
+	return found
 }
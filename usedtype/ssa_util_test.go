@@ -23,27 +23,27 @@ func TestInstrPos(t *testing.T) {
 		expect string
 	}{
 		{
-			instrs[1],
+			instrs[2],
 			fmt.Sprintf(`%s/main.go:19:5`, pathInstrPos),
 		},
 		{
-			instrs[4],
+			instrs[5],
 			fmt.Sprintf(`%s/main.go:22:11`, pathInstrPos),
 		},
 		{
-			instrs[8],
+			instrs[9],
 			fmt.Sprintf(`%s/main.go:26:4`, pathInstrPos),
 		},
 		{
-			instrs[13],
+			instrs[12],
 			fmt.Sprintf(`%s/main.go:30:19`, pathInstrPos),
 		},
 		{
-			instrs[16],
+			instrs[13],
 			fmt.Sprintf(`%s/main.go:35:2`, pathInstrPos),
 		},
 		{
-			instrs[17],
+			instrs[14],
 			fmt.Sprintf(`%s/main.go:35:5`, pathInstrPos),
 		},
 	}
@@ -53,3 +53,62 @@ func TestInstrPos(t *testing.T) {
 		require.Equal(t, c.expect, pos.String(), idx)
 	}
 }
+
+func TestLookupInstrPositionUnknown(t *testing.T) {
+	pkgs, _, _, err := usedtype.BuildPackages(pathInstrPos, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+
+	// An instruction without any position, referrer or enclosing function
+	pos, ok := usedtype.LookupInstrPosition(pkgs[0].Fset, &ssa.Alloc{})
+	require.False(t, ok)
+	require.False(t, pos.IsValid())
+	require.Equal(t, "-", usedtype.InstrPosition(pkgs[0].Fset, &ssa.Alloc{}).String())
+}
+
+func TestLookupInstrPositionFallback(t *testing.T) {
+	pkgs, ssapkgs, _, err := usedtype.BuildPackages(pathInstrPosFallback, []string{"."}, usedtype.CallGraphTypeNA)
+	require.NoError(t, err)
+	fset := pkgs[0].Fset
+
+	mainFn := ssapkgs[0].Func("main")
+	closure := mainFn.AnonFuncs[0]
+	initFn := ssapkgs[0].Func("init")
+
+	cases := []struct {
+		instr  ssa.Instruction
+		expect string
+	}{
+		// Resolved by the referrer: the element address is stored with the position of the element.
+		{
+			mainFn.Blocks[0].Instrs[1],
+			fmt.Sprintf(`%s/main.go:11:16`, pathInstrPosFallback),
+		},
+		// Resolved by the referrer of the referrer: the range index is incremented and then used as the index.
+		{
+			mainFn.Blocks[1].Instrs[0],
+			fmt.Sprintf(`%s/main.go:14:20`, pathInstrPosFallback),
+		},
+		// Resolved by the enclosing function: the implicit call to len() of the range loop.
+		{
+			mainFn.Blocks[0].Instrs[9],
+			fmt.Sprintf(`%s/main.go:9:6`, pathInstrPosFallback),
+		},
+		// Resolved by the enclosing closure, rather than its parent.
+		{
+			closure.Blocks[0].Instrs[2],
+			fmt.Sprintf(`%s/main.go:19:2`, pathInstrPosFallback),
+		},
+	}
+
+	for idx, c := range cases {
+		require.False(t, c.instr.Pos().IsValid(), idx)
+		pos, ok := usedtype.LookupInstrPosition(fset, c.instr)
+		require.True(t, ok, idx)
+		require.Equal(t, c.expect, pos.String(), idx)
+	}
+
+	// The synthetic package initializer has no position at all.
+	pos, ok := usedtype.LookupInstrPosition(fset, initFn.Blocks[0].Instrs[0])
+	require.False(t, ok)
+	require.False(t, pos.IsValid())
+}
@@ -0,0 +1,332 @@
+package usedtype
+
+import (
+	"context"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// ValueFlowGraph is a context insensitive value flow graph among the SSA values of a program, which is built by
+// following the def-use chains. It is used to tell whether a value refers to (part of) the same instance as a root.
+//
+// An edge from value v1 to v2 means that v2 refers to (part of) the instance that v1 refers to. The edges are:
+//   - Between the values that refer to the same instance in a function, in both directions. E.g. a pointer and the
+//     value loaded from it, the address and the value stored to it, the incoming values of a phi node, etc.
+//   - From a container value to its element values. E.g. a structure to its field, a slice, an array or a map to its
+//     element cell. So that an instance is regarded as containing the instances stored into its fields, but not the
+//     other way around.
+//   - Between the element cell of a container and its element values, in both directions. A container has one element
+//     cell shared by all its index addresses, indexes, lookups and map updates, so that the element stored via one
+//     access flows to the others. The element cells of the containers that refer to the same underlying storage (e.g.
+//     a slice and the array it slices, or the slices passed to append and copy) are linked in both directions.
+//   - From a call argument to the parameter, and from a closure binding to the free variable.
+//   - Between the returned value and the call result, in both directions.
+//   - Between the addresses of the same field of the same structure value, in both directions.
+//
+// As the edges from the parameters back to the call arguments are not included, an instance passed to a function
+// doesn't flow to the other instances passed to the same function.
+type ValueFlowGraph struct {
+	edges map[ssa.Value][]ssa.Value
+	cells map[ssa.Value]*elemCell
+}
+
+// elemCell is the synthetic value that stands for all the elements of a container value.
+type elemCell struct {
+	ssa.Value
+}
+
+// NewValueFlowGraph builds the value flow graph for all the functions in the program. The call graph, if non-nil, is
+// used to resolve the callees of the dynamic calls. Otherwise, only the static calls are followed.
+func NewValueFlowGraph(prog *ssa.Program, graph *callgraph.Graph) *ValueFlowGraph {
+	g, _ := NewValueFlowGraphContext(context.Background(), prog, graph)
+	return g
+}
+
+// NewValueFlowGraphContext is like NewValueFlowGraph, but stops once the context is done, and returns a *StageError
+// together with the partial graph, which misses the edges of the functions that haven't been walked through.
+func NewValueFlowGraphContext(ctx context.Context, prog *ssa.Program, graph *callgraph.Graph) (*ValueFlowGraph, error) {
+	g := &ValueFlowGraph{
+		edges: map[ssa.Value][]ssa.Value{},
+		cells: map[ssa.Value]*elemCell{},
+	}
+	// The field addresses of the same field of the same structure value refer to the same location.
+	fieldAddrs := map[fieldAddrKey]ssa.Value{}
+	for fn := range ssautil.AllFunctions(prog) {
+		if err := checkStage(ctx, StageBuildValueFlow); err != nil {
+			return g, err
+		}
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				g.addInstruction(instr, graph)
+				if instr, ok := instr.(*ssa.FieldAddr); ok {
+					k := fieldAddrKey{x: instr.X, field: instr.Field}
+					if v, ok := fieldAddrs[k]; ok {
+						g.addCopy(v, instr)
+					} else {
+						fieldAddrs[k] = instr
+					}
+				}
+			}
+		}
+	}
+	return g, nil
+}
+
+type fieldAddrKey struct {
+	x     ssa.Value
+	field int
+}
+
+// MergeValueFlowGraphs merges the value flow graphs, e.g. the ones built from the programs of different build
+// configurations (see LoadOptions). The nil graphs are skipped.
+func MergeValueFlowGraphs(graphs ...*ValueFlowGraph) *ValueFlowGraph {
+	var out *ValueFlowGraph
+	for _, g := range graphs {
+		if g == nil {
+			continue
+		}
+		if out == nil {
+			out = &ValueFlowGraph{
+				edges: map[ssa.Value][]ssa.Value{},
+			}
+		}
+		for v, vs := range g.edges {
+			out.edges[v] = append(out.edges[v], vs...)
+		}
+	}
+	return out
+}
+
+func (g *ValueFlowGraph) addEdge(from, to ssa.Value) {
+	if from == nil || to == nil {
+		return
+	}
+	g.edges[from] = append(g.edges[from], to)
+}
+
+func (g *ValueFlowGraph) addCopy(v1, v2 ssa.Value) {
+	g.addEdge(v1, v2)
+	g.addEdge(v2, v1)
+	if v1 != nil && v2 != nil && hasElems(v1.Type()) && hasElems(v2.Type()) {
+		c1, c2 := g.cell(v1), g.cell(v2)
+		g.addEdge(c1, c2)
+		g.addEdge(c2, c1)
+	}
+}
+
+// cell returns the element cell of the container value, which is created on first use.
+func (g *ValueFlowGraph) cell(v ssa.Value) ssa.Value {
+	if v == nil {
+		return nil
+	}
+	if c, ok := g.cells[v]; ok {
+		return c
+	}
+	c := &elemCell{Value: v}
+	g.cells[v] = c
+	g.addEdge(v, c)
+	return c
+}
+
+// hasElems tells whether the type, or the type it points to, is a slice, an array or a map.
+func hasElems(t types.Type) bool {
+	if ptr, ok := t.Underlying().(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	switch t.Underlying().(type) {
+	case *types.Slice, *types.Array, *types.Map:
+		return true
+	}
+	return false
+}
+
+func (g *ValueFlowGraph) addInstruction(instr ssa.Instruction, graph *callgraph.Graph) {
+	switch instr := instr.(type) {
+	case *ssa.Store:
+		g.addCopy(instr.Addr, instr.Val)
+	case *ssa.UnOp:
+		if instr.Op == token.MUL {
+			g.addCopy(instr, instr.X)
+		}
+	case *ssa.Phi:
+		for _, e := range instr.Edges {
+			g.addCopy(instr, e)
+		}
+	case *ssa.ChangeType:
+		g.addCopy(instr, instr.X)
+	case *ssa.MakeInterface:
+		g.addCopy(instr, instr.X)
+	case *ssa.ChangeInterface:
+		g.addCopy(instr, instr.X)
+	case *ssa.TypeAssert:
+		g.addCopy(instr, instr.X)
+	case *ssa.Slice:
+		g.addCopy(instr, instr.X)
+	case *ssa.Extract:
+		// The extracted call results are linked to the returned values at the call site.
+		if _, ok := instr.Tuple.(*ssa.Call); !ok && instr.Index == 0 {
+			g.addCopy(instr, instr.Tuple)
+		}
+		// The value iterated from a map is its element.
+		if next, ok := instr.Tuple.(*ssa.Next); ok && !next.IsString && instr.Index == 2 {
+			g.addCopy(g.cell(next.Iter.(*ssa.Range).X), instr)
+		}
+	case *ssa.MakeClosure:
+		fn := instr.Fn.(*ssa.Function)
+		for i, binding := range instr.Bindings {
+			if i < len(fn.FreeVars) {
+				g.addEdge(binding, fn.FreeVars[i])
+			}
+		}
+	case *ssa.FieldAddr:
+		g.addEdge(instr.X, instr)
+	case *ssa.Field:
+		g.addEdge(instr.X, instr)
+	case *ssa.IndexAddr:
+		g.addCopy(g.cell(instr.X), instr)
+	case *ssa.Index:
+		g.addCopy(g.cell(instr.X), instr)
+	case *ssa.Lookup:
+		g.addCopy(g.cell(instr.X), instr)
+	case *ssa.MapUpdate:
+		g.addCopy(g.cell(instr.Map), instr.Value)
+	case *ssa.Call:
+		g.addBuiltinCall(instr)
+	}
+
+	if site, ok := instr.(ssa.CallInstruction); ok {
+		for _, callee := range siteCallees(site, graph) {
+			g.addCall(site, callee)
+		}
+	}
+}
+
+// addBuiltinCall links the elements of the slices passed to the append and copy builtins.
+func (g *ValueFlowGraph) addBuiltinCall(call *ssa.Call) {
+	builtin, ok := call.Call.Value.(*ssa.Builtin)
+	if !ok {
+		return
+	}
+	args := call.Call.Args
+	switch builtin.Name() {
+	case "append":
+		// The appended slice is either a slice of the same element type, or a string (e.g. append(b, s...)).
+		g.addCopy(call, args[0])
+		if len(args) > 1 && hasElems(args[1].Type()) {
+			g.addCopy(g.cell(call), g.cell(args[1]))
+		}
+	case "copy":
+		if hasElems(args[1].Type()) {
+			g.addCopy(g.cell(args[0]), g.cell(args[1]))
+		}
+	}
+}
+
+// addCall links the arguments to the parameters, and the returned values to the call results.
+func (g *ValueFlowGraph) addCall(site ssa.CallInstruction, callee *ssa.Function) {
+	common := site.Common()
+	args := common.Args
+	if common.IsInvoke() {
+		args = append([]ssa.Value{common.Value}, args...)
+	}
+	for i, arg := range args {
+		if i < len(callee.Params) {
+			g.addEdge(arg, callee.Params[i])
+		}
+	}
+
+	v := site.Value()
+	if v == nil {
+		// go and defer
+		return
+	}
+	var results []ssa.Value
+	if callee.Signature.Results().Len() > 1 {
+		if referrers := v.Referrers(); referrers != nil {
+			for _, ref := range *referrers {
+				if extract, ok := ref.(*ssa.Extract); ok {
+					for len(results) <= extract.Index {
+						results = append(results, nil)
+					}
+					results[extract.Index] = extract
+				}
+			}
+		}
+	} else {
+		results = []ssa.Value{v}
+	}
+	for _, b := range callee.Blocks {
+		ret, ok := b.Instrs[len(b.Instrs)-1].(*ssa.Return)
+		if !ok {
+			continue
+		}
+		for i, result := range ret.Results {
+			if i < len(results) {
+				g.addCopy(results[i], result)
+			}
+		}
+	}
+}
+
+// siteCallees returns the callees of the call site, which are either the static callee, or the callees found in the
+// call graph.
+func siteCallees(site ssa.CallInstruction, graph *callgraph.Graph) []*ssa.Function {
+	if callee := site.Common().StaticCallee(); callee != nil {
+		return []*ssa.Function{callee}
+	}
+	if graph == nil {
+		return nil
+	}
+	node := graph.Nodes[site.Parent()]
+	if node == nil {
+		return nil
+	}
+	var callees []*ssa.Function
+	for _, e := range node.Out {
+		if e.Site == site {
+			callees = append(callees, e.Callee.Func)
+		}
+	}
+	return callees
+}
+
+// Flow returns the values that the instance referred by the value v flows to, including v itself.
+func (g *ValueFlowGraph) Flow(v ssa.Value) map[ssa.Value]struct{} {
+	out := map[ssa.Value]struct{}{}
+	if v == nil {
+		return out
+	}
+	out[v] = struct{}{}
+	wl := []ssa.Value{v}
+	for len(wl) != 0 {
+		v := wl[len(wl)-1]
+		wl = wl[:len(wl)-1]
+		for _, next := range g.edges[v] {
+			if _, ok := out[next]; ok {
+				continue
+			}
+			out[next] = struct{}{}
+			wl = append(wl, next)
+		}
+	}
+	return out
+}
+
+// accessedValue returns the structure value (or its address) that is accessed by the virtual access point. For an
+// implicit access point, it is the argument that is (un)marshaled or reflected by the call.
+func accessedValue(vap VirtAccessPoint) ssa.Value {
+	if vap.value != nil {
+		return vap.value
+	}
+	switch instr := vap.Instr.(type) {
+	case *ssa.FieldAddr:
+		return instr.X
+	case *ssa.Field:
+		return instr.X
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package usedtype
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stage is a stage of the analysis pipeline.
+type Stage string
+
+const (
+	StageLoadPackages     Stage = "load packages"
+	StageBuildSSA         Stage = "build SSA"
+	StageBuildCallGraph   Stage = "build call graph"
+	StageFindRoots        Stage = "find named type roots"
+	StageFindDirectUsages Stage = "find structure direct usages"
+	StageAnalyzePointsTo  Stage = "analyze points-to"
+	StageBuildValueFlow   Stage = "build value flow graph"
+	StageBuildFullUsages  Stage = "build structure full usages"
+)
+
+// StageError is returned by the context aware functions (e.g. BuildPackagesContext) when the context is done before
+// the stage finishes. The results returned together with it are partial.
+type StageError struct {
+	Stage Stage
+	// Err is the context's error, i.e. context.Canceled or context.DeadlineExceeded.
+	Err error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s interrupted: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// checkStage returns a StageError of the stage if the context is done.
+func checkStage(ctx context.Context, stage Stage) error {
+	if err := ctx.Err(); err != nil {
+		return &StageError{Stage: stage, Err: err}
+	}
+	return nil
+}
+
+// runStage runs f in a goroutine, and returns a StageError of the stage once the context is done, without waiting for
+// f. It is used for the stages that can't be cancelled (e.g. the pointer analysis): f is left running to completion in
+// the background, so that the caller must not use the results written by f if a StageError is returned.
+func runStage(ctx context.Context, stage Stage, f func()) error {
+	if err := checkStage(ctx, stage); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return &StageError{Stage: stage, Err: ctx.Err()}
+	}
+}
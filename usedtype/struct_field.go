@@ -16,6 +16,11 @@ func (u StructField) Exported() bool {
 	return u.base.Field(u.index).Exported()
 }
 
+// Embedded checks whether the field is an embedded field.
+func (u StructField) Embedded() bool {
+	return u.base.Field(u.index).Embedded()
+}
+
 func (u StructField) DereferenceRElem() types.Type {
 	return DereferenceRElem(u.base.Field(u.index).Type())
 }
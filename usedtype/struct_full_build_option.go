@@ -10,12 +10,91 @@ import (
 // Note that the user has to ensure the "itf"'s underlying type is an interface.
 type CustomImplements func(v types.Type, itf *types.Named) bool
 
+// StructFullBuildProgress is called each time the full usages of a root (i.e. a StructFullUsageKey) are built, with
+// the number of the roots that are done, the total number of the roots, and the type just built.
+type StructFullBuildProgress func(done, total int, current *types.Named)
+
 type StructFullBuildOption struct {
 	// If non-nil, the struct full build process will further check the reachability based on the call graph when extending the properties.
 	Callgraph *callgraph.Graph
 
+	// If true, the reachability check based on the call graph is stricter: an instruction is only regarded to precede
+	// the other one if it dominates the other one (see ssa.BasicBlock.Dominates), i.e. it is executed on every path
+	// to the other one, rather than on some path. For the instructions in different functions, it has to dominate
+	// one of the call sites that lead to the other function, or vice versa.
+	// Note that this may miss the usages, e.g. the field accessed in a branch before the root is allocated.
+	Dominance bool
+
+	// If non-nil, the struct full build process will further check whether the instance of the root flows to the
+	// structure whose field is accessed, based on the value flow graph (see ValueFlowGraph). Otherwise, the field
+	// accesses on any instance of the same type are regarded as used.
+	ValueFlow *ValueFlowGraph
+
+	// If non-nil, the struct full build process will further check whether the structure whose field is accessed may
+	// point to the same instance as the root, based on the pointer analysis (see AnalyzePointsTo). The roots and the
+	// accesses without points-to information are checked as if this is not set.
+	PointsTo *PointsTo
+
 	// If non-nil, it is used to check whether a type implement an interface, which affects the result that diverges structures from an interface during the usage build.
 	// If this is not set, the default function used for this check is the `types.Implements()` defined in go/types package.
 	// Note that in almost all the cases, you will leave it as nil.
 	CustomImplements CustomImplements
+
+	// If true, the fields of the embedded structures are collapsed into the outer structure as the promoted fields
+	// (see StructFieldFullUsageKey.Via), rather than being nested under the embedded fields. This affects both the
+	// full usages and the struct trees (i.e. the unused fields and the coverage).
+	CollapseEmbedded bool
+
+	// If true, the struct trees (see BuildStructTrees) also include the unexported fields of the structures defined in
+	// the same package as the root type, so that they can be reported as unused. The usages of the unexported fields
+	// are only found if the direct usage map is built with StructDirectUsageOption.IncludeUnexported.
+	IncludeUnexported bool
+
+	// If true, the fields of function types are followed to the structures returned by the functions, as the fields
+	// of map and channel types are followed to the structures they hold (see ElemTypes).
+	FollowFuncResults bool
+
+	// Generic specifies how the instantiated generic types are looked up in the direct usage map, which should be the
+	// same as the one used to build the map (see StructDirectUsageOption.Generic).
+	Generic GenericMode
+
+	// GenericContext dedupes the identical instantiations of the generic types, which should be the same as the one
+	// used to build the direct usage map (see NewGenericContext).
+	GenericContext *types.Context
+
+	// If true, all the virtual access points of each field are recorded. Otherwise, only the first one is recorded,
+	// which is enough to tell whether the field is used.
+	RecordAllAccessPoints bool
+
+	// The maximum number of roots to build concurrently. If this is not set (i.e. 0), it defaults to GOMAXPROCS.
+	Concurrency int
+
+	// If non-nil, it is called to report the build progress. The calls are serialized.
+	Progress StructFullBuildProgress
+}
+
+func (opt *StructFullBuildOption) dominance() bool {
+	return opt != nil && opt.Dominance
+}
+
+func (opt *StructFullBuildOption) followFuncResults() bool {
+	return opt != nil && opt.FollowFuncResults
+}
+
+func (opt *StructFullBuildOption) recordAllAccessPoints() bool {
+	return opt != nil && opt.RecordAllAccessPoints
+}
+
+func (opt *StructFullBuildOption) genericMode() GenericMode {
+	if opt == nil {
+		return GenericModeNA
+	}
+	return opt.Generic
+}
+
+func (opt *StructFullBuildOption) genericContext() *types.Context {
+	if opt == nil {
+		return nil
+	}
+	return opt.GenericContext
 }
@@ -0,0 +1,34 @@
+package usedtype
+
+import "sync/atomic"
+
+// StructFullRenderOption controls how the struct full usages are rendered, as text (e.g. StructFullUsages.Render)
+// or as JSON (e.g. StructFullUsages.ToJSON). A nil option renders the default output, which is non verbose unless
+// changed by SetStructFieldUsageVerbose.
+type StructFullRenderOption struct {
+	// If true, each instance (i.e. the usage among each Alloc) of a struct full usage is rendered separately, together
+	// with the position of the Alloc and the positions of the virtual access points. Otherwise, all the instances are
+	// flattened into one.
+	// Note that only the first virtual access point of each field is recorded, unless the full usages are built with
+	// StructFullBuildOption.RecordAllAccessPoints.
+	Verbose bool
+}
+
+// defaultRenderOption is used in place of a nil StructFullRenderOption.
+var defaultRenderOption atomic.Pointer[StructFullRenderOption]
+
+// SetStructFieldUsageVerbose sets whether the struct full usages are rendered verbosely when no option is given (e.g.
+// via String()). It only affects rendering, only the first virtual access point of each field is rendered unless the
+// full usages are built with StructFullBuildOption.RecordAllAccessPoints.
+//
+// Deprecated: Use StructFullRenderOption.Verbose instead.
+func SetStructFieldUsageVerbose(enabled bool) {
+	defaultRenderOption.Store(&StructFullRenderOption{Verbose: enabled})
+}
+
+func (opt *StructFullRenderOption) verbose() bool {
+	if opt == nil {
+		opt = defaultRenderOption.Load()
+	}
+	return opt != nil && opt.Verbose
+}
@@ -0,0 +1,7 @@
+module access_kind
+
+go 1.15
+
+require sdk v0.0.0
+
+replace sdk => ../sdk
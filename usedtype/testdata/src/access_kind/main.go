@@ -0,0 +1,17 @@
+package main
+
+import (
+	"sdk"
+)
+
+func main() {
+	req := sdk.ModelA{}
+	req.String = "foo"
+	req.Property.Int++
+	_ = req.PointerOfProperty.Int
+	setStrings(&req.ArrayOfString)
+}
+
+func setStrings(p *[]string) {
+	*p = []string{"a"}
+}
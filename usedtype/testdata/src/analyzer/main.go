@@ -0,0 +1,11 @@
+package main // want package:`usedtype\(sdk.ModelA\{Property, String\}; sdk.Property\{Int\}\)`
+
+import (
+	"sdk"
+)
+
+func main() {
+	req := sdk.ModelA{String: "foo"} // want `ModelA.String is used \(write\)`
+	req.Property.Int = 1             // want `ModelA.Property is used \(write\)` `Property.Int is used \(write\)`
+	_ = req
+}
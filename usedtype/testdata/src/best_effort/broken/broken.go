@@ -0,0 +1,11 @@
+package broken
+
+import (
+	"sdk"
+)
+
+func Build() sdk.ModelA {
+	return sdk.ModelA{
+		Property: undefined,
+	}
+}
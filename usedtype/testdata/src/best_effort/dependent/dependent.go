@@ -0,0 +1,10 @@
+package dependent
+
+import (
+	"best_effort/broken"
+)
+
+func Build() {
+	model := broken.Build()
+	model.ArrayOfString = []string{"a"}
+}
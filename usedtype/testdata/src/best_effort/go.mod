@@ -0,0 +1,7 @@
+module best_effort
+
+go 1.15
+
+require sdk v0.0.0
+
+replace sdk => ../sdk
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"sdk"
+)
+
+func main() {
+	req := sdk.ModelA{
+		String: "foo",
+	}
+	_ = req
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"a/model"
+)
+
+func main() {
+	r := &model.Resource{
+		Tags:   map[string]*model.Tag{},
+		Lookup: map[model.Index]model.Tag{},
+		Events: make(chan model.Event, 1),
+		NewBuilder: func() *model.Builder {
+			return &model.Builder{}
+		},
+	}
+	_ = r.Tags["a"].Key
+	for k, v := range r.Lookup {
+		_ = k.ID
+		_ = v.Value
+	}
+	e := <-r.Events
+	_ = e.Name
+	_ = r.NewBuilder().Size
+}
@@ -0,0 +1,28 @@
+package model
+
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type Index struct {
+	ID    string `json:"id"`
+	Scope string `json:"scope"`
+}
+
+type Event struct {
+	Name string `json:"name"`
+	Time int    `json:"time"`
+}
+
+type Builder struct {
+	Size  int `json:"size"`
+	Count int `json:"count"`
+}
+
+type Resource struct {
+	Tags       map[string]*Tag `json:"tags"`
+	Lookup     map[Index]Tag   `json:"lookup"`
+	Events     chan Event
+	NewBuilder func() *Builder
+}
@@ -0,0 +1,27 @@
+package expand
+
+import (
+	"sdk"
+)
+
+func Expand(model *sdk.ModelA) {
+	model.String = "x"
+	expandProperty(&model.Property)
+}
+
+func expandProperty(prop *sdk.Property) {
+	prop.Int = 1
+}
+
+func ExpandPointer(model *sdk.ModelA) {
+	if model.PointerOfProperty != nil {
+		expandProperty(model.PointerOfProperty)
+	}
+}
+
+func ExpandNested(model *sdk.ModelA, depth int) {
+	if depth > 0 {
+		ExpandNested(model, depth-1)
+	}
+	model.ArrayOfString = nil
+}
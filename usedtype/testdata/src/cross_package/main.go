@@ -0,0 +1,14 @@
+package main
+
+import (
+	"a/expand"
+	"sdk"
+)
+
+func main() {
+	model := sdk.ModelA{}
+	expand.Expand(&model)
+	expand.ExpandPointer(&model)
+	expand.ExpandNested(&model, 3)
+	_ = model
+}
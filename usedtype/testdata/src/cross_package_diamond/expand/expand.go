@@ -0,0 +1,37 @@
+package expand
+
+import (
+	"sdk"
+)
+
+// Expand reaches expandCommon via two diamond shaped call chains in a row.
+func Expand(model *sdk.ModelA) {
+	expandLeft(model)
+	expandRight(model)
+}
+
+func expandLeft(model *sdk.ModelA) {
+	expandMiddle(model)
+}
+
+func expandRight(model *sdk.ModelA) {
+	expandMiddle(model)
+}
+
+func expandMiddle(model *sdk.ModelA) {
+	model.Property.Int = 1
+	expandTop(model)
+	expandBottom(model)
+}
+
+func expandTop(model *sdk.ModelA) {
+	expandCommon(model)
+}
+
+func expandBottom(model *sdk.ModelA) {
+	expandCommon(model)
+}
+
+func expandCommon(model *sdk.ModelA) {
+	model.String = "x"
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"a/expand"
+	"sdk"
+)
+
+func main() {
+	model := sdk.ModelA{}
+	expand.Expand(&model)
+	_ = model
+}
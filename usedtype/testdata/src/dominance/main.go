@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"sdk"
+)
+
+func main() {
+	useProperty()
+	if len(os.Args) > 1 {
+		a := &sdk.ModelA{}
+		_ = a
+	} else {
+		useString()
+	}
+	useArrayOfString()
+}
+
+func useProperty() {
+	var m *sdk.ModelA
+	_ = m.Property
+}
+
+func useString() {
+	var m *sdk.ModelA
+	_ = m.String
+}
+
+func useArrayOfString() {
+	var m *sdk.ModelA
+	_ = m.ArrayOfString
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"a/model"
+)
+
+func main() {
+	vm := model.VirtualMachine{Base: &model.Base{}}
+	_ = vm.Name
+	_ = vm.Size
+	_ = vm.Location
+}
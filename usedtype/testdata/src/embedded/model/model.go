@@ -0,0 +1,16 @@
+package model
+
+type Resource struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Base struct {
+	Resource
+	Location string `json:"location"`
+}
+
+type VirtualMachine struct {
+	*Base
+	Size string `json:"size"`
+}
@@ -0,0 +1,14 @@
+package list
+
+import (
+	"a/model"
+)
+
+func NextLink(p *model.Page[model.VirtualMachine]) *string {
+	return p.NextLink
+}
+
+// Single returns a page that holds all the items.
+func Single[T any](items []T) *model.Page[T] {
+	return &model.Page[T]{Items: items, Count: len(items)}
+}
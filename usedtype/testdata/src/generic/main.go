@@ -0,0 +1,21 @@
+package main
+
+import (
+	"a/list"
+	"a/model"
+)
+
+func main() {
+	vms := &model.Page[model.VirtualMachine]{}
+	for _, vm := range vms.Items {
+		_ = vm.Name
+	}
+	_ = list.NextLink(vms)
+
+	disks := &model.Page[model.Disk]{}
+	disks.Count = 1
+
+	for page := list.Single([]model.Disk{}); page.HasNext(); {
+		break
+	}
+}
@@ -0,0 +1,22 @@
+package model
+
+type Page[T any] struct {
+	Items    []T     `json:"items"`
+	NextLink *string `json:"nextLink"`
+	Count    int     `json:"count"`
+}
+
+type VirtualMachine struct {
+	Name string `json:"name"`
+	Size string `json:"size"`
+}
+
+type Disk struct {
+	Name string `json:"name"`
+	Tier string `json:"tier"`
+}
+
+// HasNext tells whether there is a next page.
+func (p *Page[T]) HasNext() bool {
+	return p.NextLink != nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"sdk"
+)
+
+var defaultModel = sdk.ModelA{String: "x"}
+
+var defaultModelPtr = &sdk.ModelA{ArrayOfString: []string{"x"}}
+
+func init() {
+	defaultModel.PointerOfProperty = &sdk.Property{}
+}
+
+func main() {
+	_ = defaultModel.Property
+	_ = defaultModelPtr.PropWrapper
+	model := sdk.ModelA{}
+	_ = model.ArrOfPropWrapper
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"a/model"
+)
+
+func main() {
+	var cfg model.Config
+	_ = json.Unmarshal([]byte("{}"), &cfg)
+
+	r := &model.Reflected{}
+	reflect.ValueOf(r).Elem().FieldByName("Kind").SetString("x")
+	_, _ = reflect.TypeOf(model.Reflected{}).FieldByName("ID")
+}
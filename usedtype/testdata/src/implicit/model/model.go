@@ -0,0 +1,27 @@
+package model
+
+type Config struct {
+	Name   string          `json:"name"`
+	Secret string          `json:"-"`
+	Nested *Nested         `json:"nested"`
+	Tags   map[string]*Tag `json:"tags"`
+	state  int
+}
+
+type Nested struct {
+	Enabled bool `json:"enabled"`
+}
+
+type Tag struct {
+	Value string `json:"value"`
+}
+
+type Base struct {
+	ID string
+}
+
+type Reflected struct {
+	Base
+	Kind string
+	Size int
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"a/codec"
+	"a/model"
+)
+
+func main() {
+	cfg := &model.Config{}
+	_ = codec.Decode([]byte("{}"), cfg)
+
+	other := &model.Config{}
+	other.Name = "y"
+}
@@ -0,0 +1,16 @@
+package model
+
+type Config struct {
+	Name   string          `json:"name"`
+	Secret string          `json:"-"`
+	Nested *Nested         `json:"nested"`
+	Tags   map[string]*Tag `json:"tags"`
+}
+
+type Nested struct {
+	Enabled bool `json:"enabled"`
+}
+
+type Tag struct {
+	Value string `json:"value"`
+}
@@ -0,0 +1,22 @@
+package main
+
+type Foo struct {
+	I int
+}
+
+func consume(v interface{}) {}
+
+func main() {
+	// The elements of a composite literal slice are addressed without a position
+	foos := []Foo{{I: 1}}
+
+	// The range index is maintained without a position
+	for _, f := range foos {
+		consume(f.I)
+	}
+
+	// The closure returns implicitly
+	func() {
+		consume(Foo{})
+	}()
+}
@@ -0,0 +1,11 @@
+// +build foo
+
+package main
+
+import (
+	"sdk"
+)
+
+func setProperty(req *sdk.ModelA) {
+	req.Property = sdk.Property{Int: 1}
+}
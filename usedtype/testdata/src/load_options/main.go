@@ -0,0 +1,14 @@
+package main
+
+import (
+	"sdk"
+)
+
+func main() {
+	req := sdk.ModelA{
+		String: "foo",
+	}
+	setProperty(&req)
+	setPlatformProperty(&req)
+	_ = req
+}
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"sdk"
+)
+
+func setPlatformProperty(req *sdk.ModelA) {
+	req.ArrayOfString = []string{"linux"}
+}
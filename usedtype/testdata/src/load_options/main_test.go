@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"sdk"
+)
+
+func TestModel(t *testing.T) {
+	req := sdk.ModelA{
+		PointerOfProperty: &sdk.Property{},
+	}
+	_ = req
+}
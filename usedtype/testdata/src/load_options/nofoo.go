@@ -0,0 +1,9 @@
+// +build !foo
+
+package main
+
+import (
+	"sdk"
+)
+
+func setProperty(req *sdk.ModelA) {}
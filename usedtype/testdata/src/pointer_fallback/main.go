@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+
+	"sdk"
+)
+
+func main() {
+	a := &sdk.ModelA{}
+	a.String = "a"
+
+	b := &sdk.ModelA{}
+	b.ArrayOfString = []string{"b"}
+
+	fmt.Println(a, b)
+}
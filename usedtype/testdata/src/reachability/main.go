@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"sdk"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		a := &sdk.ModelA{}
+		_ = a
+	} else {
+		useString()
+	}
+	useProperty()
+}
+
+func useString() {
+	var m *sdk.ModelA
+	_ = m.String
+}
+
+func useProperty() {
+	var m *sdk.ModelA
+	_ = m.Property
+}
@@ -0,0 +1,29 @@
+package main
+
+func main() {
+	ping(1)
+	leaf()
+}
+
+// ping and pong are mutually recursive.
+func ping(n int) {
+	if n > 0 {
+		pong(n - 1)
+	}
+}
+
+func pong(n int) {
+	if n > 0 {
+		ping(n - 1)
+	}
+	countdown(n)
+}
+
+// countdown calls itself.
+func countdown(n int) {
+	if n > 0 {
+		countdown(n - 1)
+	}
+}
+
+func leaf() {}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"sdk"
+)
+
+var global sdk.Property
+
+func get() (*sdk.ModelA, error) {
+	return nil, nil
+}
+
+func getProp() sdk.Property {
+	return global
+}
+
+func main() {
+	resp, _ := get()
+	_ = resp.String
+
+	prop := getProp()
+	_ = prop.Int
+
+	read(resp)
+
+	var animal sdk.Animal = getDog()
+	dog := animal.(*sdk.Dog)
+	_ = dog.Name
+}
+
+func getDog() *sdk.Dog {
+	return nil
+}
+
+func read(m *sdk.ModelA) {
+	_ = (*m).String
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"a/model"
+)
+
+func main() {
+	m := model.New("x")
+	_ = m.Name
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+type Model struct {
+	Name    string `json:"name"`
+	state   int
+	deleted bool
+	created time.Time
+}
+
+func New(name string) *Model {
+	m := &Model{Name: name}
+	m.state = 1
+	return m
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"sdk"
+)
+
+func main() {
+	a := sdk.ModelA{}
+	a.String = "a"
+	a.Property = newProp()
+	send(a)
+
+	b := &sdk.ModelA{}
+	b.PointerOfProperty = &sdk.Property{}
+	setInt(b.PointerOfProperty)
+	sendPtr(b)
+
+	c := sdk.ModelA{}
+	c.ArrayOfString = []string{"c"}
+	send(c)
+}
+
+func newProp() sdk.Property {
+	return sdk.Property{Int: 1}
+}
+
+func setInt(p *sdk.Property) {
+	p.Int = 2
+}
+
+func send(m sdk.ModelA) {
+	_ = m.String
+}
+
+func sendPtr(m *sdk.ModelA) {}
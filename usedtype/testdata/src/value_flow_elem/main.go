@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sdk"
+)
+
+func main() {
+	// The element is accessed through a different index address of the slice.
+	a := &sdk.ModelA{}
+	as := []*sdk.ModelA{a}
+	as[0].String = "a"
+
+	// The element is appended to the slice.
+	b := &sdk.ModelA{}
+	var bs []*sdk.ModelA
+	bs = append(bs, b)
+	bs[0].ArrayOfString = []string{"b"}
+
+	// The element is copied to the slice.
+	c := &sdk.ModelA{}
+	cs := make([]*sdk.ModelA, 1)
+	copy(cs, []*sdk.ModelA{c})
+	cs[0].PointerOfProperty = &sdk.Property{}
+
+	// The element is stored into the map.
+	d := &sdk.ModelA{}
+	ds := map[string]*sdk.ModelA{}
+	ds["d"] = d
+	ds["d"].Property = sdk.Property{}
+
+	// The instance that is not in any container.
+	e := &sdk.ModelA{}
+	_ = e
+
+	rangeMap()
+}
+
+func rangeMap() {
+	// The element is iterated from the map.
+	f := &sdk.ModelA{}
+	fs := map[string]*sdk.ModelA{"f": f}
+	for _, v := range fs {
+		v.String = "f"
+	}
+}
@@ -0,0 +1,54 @@
+package usedtype
+
+import (
+	"go/types"
+)
+
+// GenericMode specifies how the instantiations of the generic named types (e.g. Page[VirtualMachine]) are reported.
+type GenericMode string
+
+const (
+	// GenericModeInstance reports each instantiation as a separate named type. The identical instantiations in
+	// different packages are regarded as the same one, as long as the analysis shares a types.Context (see
+	// NewGenericContext). Note that the usages inside the generic functions are reported
+	// on the instantiations with the type parameters of the functions (e.g. Page[T]).
+	GenericModeInstance GenericMode = "instance"
+	// GenericModeOrigin merges all the instantiations into their generic origin (e.g. Page[T any]).
+	GenericModeOrigin GenericMode = "origin"
+	// GenericModeNA is the same as GenericModeInstance.
+	GenericModeNA GenericMode = ""
+)
+
+// NewGenericContext returns a context to dedupe the identical instantiations of the generic named types, which are
+// different *types.Named if they are instantiated in different packages. The same context should be set to the
+// NamedTypeAllocSetOption, the StructDirectUsageOption and the StructFullBuildOption of one analysis, so that the
+// roots, the direct usages and the full usages refer to the same instantiation. It is only used by
+// GenericModeInstance.
+func NewGenericContext() *types.Context {
+	return types.NewContext()
+}
+
+// canonicalNamed returns the named type that stands for nt in the NamedTypeAllocSet, the StructDirectUsageMap and
+// their derivatives, according to the mode. The non-generic named types are returned as is, so are the
+// instantiations if there is no context to dedupe them.
+func canonicalNamed(nt *types.Named, mode GenericMode, instances *types.Context) *types.Named {
+	targs := nt.TypeArgs()
+	if targs.Len() == 0 {
+		return nt
+	}
+	if mode == GenericModeOrigin {
+		return nt.Origin()
+	}
+	if instances == nil {
+		return nt
+	}
+	args := make([]types.Type, targs.Len())
+	for i := range args {
+		args[i] = targs.At(i)
+	}
+	inst, err := types.Instantiate(instances, nt.Origin(), args, false)
+	if err != nil {
+		return nt
+	}
+	return inst.(*types.Named)
+}
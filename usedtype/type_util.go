@@ -15,7 +15,7 @@ func DereferenceR(T types.Type) types.Type {
 }
 
 // DereferenceRElem is like DereferenceR, but it will continue to dereference the
-// element if hit an array.
+// element if hit an array or a slice. See ElemTypes for the other containers.
 func DereferenceRElem(t types.Type) types.Type {
 	t = DereferenceR(t)
 	if arr, ok := t.(*types.Array); ok {
@@ -55,28 +55,106 @@ func IsUnderlyingNamedStructOrInterface(t types.Type) bool {
 	return IsUnderlyingNamedInterface(t) || IsUnderlyingNamedStruct(t)
 }
 
+// IsElemUnderlyingNamedInterface checks whether t, or any type held by t as a container (see ElemTypes, without
+// following the function results), is a named interface.
 func IsElemUnderlyingNamedInterface(t types.Type) bool {
-	t = DereferenceR(t)
-	switch t := t.(type) {
-	case *types.Array:
-		return IsElemUnderlyingNamedInterface(t.Elem())
-	case *types.Slice:
-		return IsElemUnderlyingNamedInterface(t.Elem())
-	default:
-		return IsUnderlyingNamedInterface(t)
+	for _, elem := range ElemTypes(t, false) {
+		if IsUnderlyingNamedInterface(elem.Type) {
+			return true
+		}
 	}
+	return false
 }
 
+// IsElemUnderlyingNamedStructOrInterface checks whether t, or any type held by t as a container (see ElemTypes,
+// without following the function results), is a named structure or interface.
 func IsElemUnderlyingNamedStructOrInterface(t types.Type) bool {
-	t = DereferenceR(t)
-	switch t := t.(type) {
-	case *types.Array:
-		return IsElemUnderlyingNamedStructOrInterface(t.Elem())
-	case *types.Slice:
-		return IsElemUnderlyingNamedStructOrInterface(t.Elem())
+	for _, elem := range ElemTypes(t, false) {
+		if IsUnderlyingNamedStructOrInterface(elem.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainerKind is the kind of the container, through which a type is held by another type.
+type ContainerKind int
+
+const (
+	// ContainerKindNone means the type is held directly, or via pointers, arrays and slices.
+	ContainerKindNone ContainerKind = iota
+	ContainerKindMapKey
+	ContainerKindMapValue
+	ContainerKindChan
+	ContainerKindFuncResult
+)
+
+func (k ContainerKind) String() string {
+	switch k {
+	case ContainerKindNone:
+		return ""
+	case ContainerKindMapKey:
+		return "map key"
+	case ContainerKindMapValue:
+		return "map value"
+	case ContainerKindChan:
+		return "chan"
+	case ContainerKindFuncResult:
+		return "func result"
 	default:
-		return IsUnderlyingNamedStructOrInterface(t)
+		panic("unreachable")
+	}
+}
+
+// ElemType is a type held by another type, together with the kind of the container that holds it.
+type ElemType struct {
+	Kind ContainerKind
+	Type types.Type
+}
+
+// ElemTypes returns the types held by t. It is like DereferenceRElem, but it also looks into the keys and values of
+// maps, the elements of channels and, if followFuncResults is true, the results of functions. For nested containers
+// (e.g. a map of channels), the kind of the outermost container is used.
+func ElemTypes(t types.Type, followFuncResults bool) []ElemType {
+	return elemTypes(t, ContainerKindNone, followFuncResults)
+}
+
+func elemTypes(t types.Type, kind ContainerKind, followFuncResults bool) []ElemType {
+	inner := func(k ContainerKind) ContainerKind {
+		if kind != ContainerKindNone {
+			return kind
+		}
+		return k
+	}
+	t = DereferenceRElem(t)
+	switch t := t.(type) {
+	case *types.Map:
+		return append(elemTypes(t.Key(), inner(ContainerKindMapKey), followFuncResults),
+			elemTypes(t.Elem(), inner(ContainerKindMapValue), followFuncResults)...)
+	case *types.Chan:
+		return elemTypes(t.Elem(), inner(ContainerKindChan), followFuncResults)
+	case *types.Signature:
+		if !followFuncResults {
+			break
+		}
+		var out []ElemType
+		for i := 0; i < t.Results().Len(); i++ {
+			out = append(out, elemTypes(t.Results().At(i).Type(), inner(ContainerKindFuncResult), followFuncResults)...)
+		}
+		return out
+	}
+	return []ElemType{{Kind: kind, Type: t}}
+}
+
+// namedElemTypes is like ElemTypes, but only returns the named structures and interfaces.
+func namedElemTypes(t types.Type, followFuncResults bool) []ElemType {
+	var out []ElemType
+	for _, elem := range ElemTypes(t, followFuncResults) {
+		if IsUnderlyingNamedStructOrInterface(elem.Type) {
+			out = append(out, elem)
+		}
 	}
+	return out
 }
 
 type namedTypes []*types.Named